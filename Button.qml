@@ -7,7 +7,7 @@ Rectangle {
 
     signal clicked
 
-    width: buttonLabel.width + 20; height: buttonLabel.height + 5
+    width: buttonLabel.width + 20 * uiScale; height: buttonLabel.height + 5 * uiScale
     border { width: 1; color: Qt.darker(activePalette.button) }
     antialiasing: true
     radius: 8
@@ -36,6 +36,7 @@ Rectangle {
         id: buttonLabel
         anchors.centerIn: container
         color: activePalette.buttonText
+        font.pixelSize: 13 * uiScale
         text: container.text
     }
     
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// durations of the phases of a move in the exported animations (in seconds), matching the
+// animations in gofusion.qml
+const (
+	slideDuration = 0.5 // tiles sliding to their new position
+	spawnDuration = 0.5 // new tile appearing, merged tiles popping
+	startHold     = 1.0 // how long the initial board is shown
+	endHold       = 3.0 // how long the final board is shown
+)
+
+// animFrame is one frame of an exported animation
+type animFrame struct {
+	img   *image.RGBA
+	delay float64 // in seconds
+}
+
+// easeOutBounce is the easing curve used for the tile animations in QML (Easing.OutBounce)
+func easeOutBounce(t float64) float64 {
+	switch {
+	case t < 1/2.75:
+		return 7.5625 * t * t
+	case t < 2/2.75:
+		t -= 1.5 / 2.75
+		return 7.5625*t*t + 0.75
+	case t < 2.5/2.75:
+		t -= 2.25 / 2.75
+		return 7.5625*t*t + 0.9375
+	}
+	t -= 2.625 / 2.75
+	return 7.5625*t*t + 0.984375
+}
+
+// gameAnimator renders the frames of a recorded game
+type gameAnimator struct {
+	theme         *Theme
+	cam           Camera
+	width, height int
+	samples       int
+	fps           float64
+
+	board  *Board
+	frames []animFrame
+}
+
+// tileAnim describes how a tile changes during one phase of the animation
+type tileAnim struct {
+	x0, y0, x1, y1 float32
+	nvalue         int
+	number         int
+	kind           tileKind
+	scale          func(t float64) float32
+}
+
+// frame renders the board with the given tile states and the score
+func (a *gameAnimator) frame(tiles []tileState, delay float64) error {
+	bw, bh := a.board.topology().extent()
+	img, err := renderBoard(a.theme, a.cam, tiles, bw, bh, a.width, a.height, a.samples)
+	if err != nil {
+		return err
+	}
+	size := float32(a.height) / 20
+	drawText(img, "SCORE "+fmt.Sprint(a.board.score), size/2, size/2, size, color.RGBA{255, 255, 255, 255})
+	a.frames = append(a.frames, animFrame{img, delay})
+	return nil
+}
+
+// phase renders the frames of one phase of the animation
+func (a *gameAnimator) phase(anims []tileAnim, duration float64) error {
+	n := int(math.Ceil(duration * a.fps))
+	for f := 1; f <= n; f++ {
+		t := float64(f) / float64(n)
+		e := float32(easeOutBounce(t))
+		var tiles []tileState
+		for _, ta := range anims {
+			s := float32(1)
+			if ta.scale != nil {
+				s = ta.scale(t)
+			}
+			tiles = append(tiles, tileState{
+				x:      ta.x0 + (ta.x1-ta.x0)*e,
+				y:      ta.y0 + (ta.y1-ta.y0)*e,
+				scale:  s,
+				alpha:  1,
+				nvalue: ta.nvalue,
+				number: ta.number,
+				kind:   ta.kind,
+			})
+		}
+		if err := a.frame(tiles, duration/float64(n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// still returns the current board as tile states
+func (a *gameAnimator) still() []tileState {
+	var tiles []tileState
+	for _, t := range a.board.tiles {
+		if t != nil {
+			tiles = append(tiles, a.board.tileState(t))
+		}
+	}
+	return tiles
+}
+
+// animate replays the recording and renders all frames
+func (a *gameAnimator) animate(r Recording) error {
+	a.board = &Board{width: boardSize, height: boardSize}
+	if err := a.board.startFrom(r); err != nil {
+		return err
+	}
+	if err := a.frame(a.still(), startHold); err != nil {
+		return err
+	}
+
+	// scale of tiles growing from nothing, and of merged tiles popping
+	grow := func(t float64) float32 { return float32(easeOutBounce(t)) }
+	pop := func(t float64) float32 { return float32(1 + 0.15*math.Sin(t*math.Pi)) }
+
+	for i := 0; i < len(r.Moves); i++ {
+		b := a.board
+		type pos struct{ x, y int }
+		before := make(map[*Tile]pos)
+		for _, t := range b.tiles {
+			if t != nil {
+				before[t] = pos{t.x, t.y}
+			}
+		}
+
+		if r.Moves[i] == stoneDrop {
+			b.replayMove(stoneDrop)
+			if err := a.frame(a.still(), spawnDuration); err != nil {
+				return err
+			}
+			continue
+		}
+		b.move(r.Moves[i])
+		if !b.moved {
+			continue
+		}
+		var slide []tileAnim
+		for _, t := range b.tiles {
+			if t != nil {
+				p := before[t]
+				x0, y0 := b.topology().pos(p.x, p.y)
+				s := b.tileState(t)
+				slide = append(slide, tileAnim{x0: x0, y0: y0, x1: s.x, y1: s.y, nvalue: s.nvalue, number: s.number, kind: s.kind})
+			}
+		}
+		if err := a.phase(slide, slideDuration); err != nil {
+			return err
+		}
+
+		merged := make(map[*Tile]bool)
+		for _, t := range b.tiles {
+			if t != nil && t.NextValue > 0 {
+				merged[t] = true
+			}
+		}
+		b.doMerge()
+		b.spawnTile()
+		b.moved = false
+
+		var spawn []tileAnim
+		for _, t := range b.tiles {
+			if t == nil {
+				continue
+			}
+			s := b.tileState(t)
+			ta := tileAnim{x0: s.x, y0: s.y, x1: s.x, y1: s.y, nvalue: s.nvalue, number: s.number, kind: s.kind}
+			if _, ok := before[t]; !ok {
+				ta.scale = grow
+			} else if merged[t] {
+				ta.scale = pop
+			}
+			spawn = append(spawn, ta)
+		}
+		if err := a.phase(spawn, spawnDuration); err != nil {
+			return err
+		}
+	}
+
+	a.frames[len(a.frames)-1].delay += endHold
+	return nil
+}
+
+// drawText draws text with the vector font at x, y (top left corner) with the given height
+func drawText(img *image.RGBA, text string, x, y, height float32, c color.RGBA) {
+	scale := height / 2
+	width := height / 10
+	var segments [][2][2]float32
+	for i, r := range text {
+		cell := x + float32(i)*(1+genDigitSpacing)*scale
+		for _, stroke := range vectorFont[r] {
+			for j := 0; j+1 < len(stroke); j++ {
+				segments = append(segments, [2][2]float32{
+					{cell + stroke[j][0]*scale, y + height - stroke[j][1]*scale},
+					{cell + stroke[j+1][0]*scale, y + height - stroke[j+1][1]*scale},
+				})
+			}
+		}
+	}
+
+	for _, s := range segments {
+		x0 := int(math.Floor(math.Min(float64(s[0][0]), float64(s[1][0])) - float64(width)))
+		x1 := int(math.Ceil(math.Max(float64(s[0][0]), float64(s[1][0])) + float64(width)))
+		y0 := int(math.Floor(math.Min(float64(s[0][1]), float64(s[1][1])) - float64(width)))
+		y1 := int(math.Ceil(math.Max(float64(s[0][1]), float64(s[1][1])) + float64(width)))
+		for py := y0; py <= y1; py++ {
+			for px := x0; px <= x1; px++ {
+				if !(image.Point{px, py}.In(img.Rect)) {
+					continue
+				}
+				d := segmentDistance(float32(px)+0.5, float32(py)+0.5, s[0], s[1])
+				cover := clamp(width/2 + 0.5 - d)
+				if cover == 0 {
+					continue
+				}
+				o := img.RGBAAt(px, py)
+				mix := func(a, b uint8) uint8 { return uint8(float32(a)*(1-cover) + float32(b)*cover + 0.5) }
+				img.SetRGBA(px, py, color.RGBA{mix(o.R, c.R), mix(o.G, c.G), mix(o.B, c.B), mix(o.A, c.A)})
+			}
+		}
+	}
+}
+
+// segmentDistance returns the distance of the point (x, y) from the line segment a-b
+func segmentDistance(x, y float32, a, b [2]float32) float32 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := float32(0)
+	if l := dx*dx + dy*dy; l > 0 {
+		t = clamp(((x-a[0])*dx + (y-a[1])*dy) / l)
+	}
+	ex, ey := x-(a[0]+t*dx), y-(a[1]+t*dy)
+	return float32(math.Sqrt(float64(ex*ex + ey*ey)))
+}
+
+// writeGIF writes the frames as animated GIF, using one palette for all frames
+func writeGIF(w io.Writer, frames []animFrame) error {
+	pal, index := gifPalette(frames)
+	anim := &gif.GIF{}
+	for _, f := range frames {
+		p := image.NewPaletted(f.img.Bounds(), pal)
+		for i := 0; i < len(f.img.Pix); i += 4 {
+			p.Pix[i/4] = index(f.img.Pix[i], f.img.Pix[i+1], f.img.Pix[i+2])
+		}
+		anim.Image = append(anim.Image, p)
+		anim.Delay = append(anim.Delay, int(math.Round(f.delay*100)))
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// gifPalette chooses the 256 most frequent colors (reduced to 5 bits per channel) of the frames
+// and returns them together with a function mapping colors to the index of the nearest one
+func gifPalette(frames []animFrame) (color.Palette, func(r, g, b uint8) uint8) {
+	bin := func(r, g, b uint8) int { return int(r>>3)<<10 | int(g>>3)<<5 | int(b>>3) }
+	count := make([]int, 1<<15)
+	for _, f := range frames {
+		for i := 0; i < len(f.img.Pix); i += 4 {
+			count[bin(f.img.Pix[i], f.img.Pix[i+1], f.img.Pix[i+2])]++
+		}
+	}
+	var used []int
+	for c, n := range count {
+		if n > 0 {
+			used = append(used, c)
+		}
+	}
+	sort.Slice(used, func(i, j int) bool { return count[used[i]] > count[used[j]] })
+	if len(used) > 256 {
+		used = used[:256]
+	}
+
+	var pal color.Palette
+	for _, c := range used {
+		pal = append(pal, color.RGBA{uint8(c>>10)<<3 | 4, uint8(c>>5&31)<<3 | 4, uint8(c&31)<<3 | 4, 255})
+	}
+
+	// nearest palette entry per bin, computed on demand
+	lookup := make([]int16, 1<<15)
+	for i := range lookup {
+		lookup[i] = -1
+	}
+	index := func(r, g, b uint8) uint8 {
+		c := bin(r, g, b)
+		if lookup[c] < 0 {
+			lookup[c] = int16(pal.Index(color.RGBA{r, g, b, 255}))
+		}
+		return uint8(lookup[c])
+	}
+	return pal, index
+}
+
+// writeAPNG writes the frames as animated PNG. Each frame is encoded with image/png, and its
+// image data is then wrapped into the APNG frame chunks.
+func writeAPNG(w io.Writer, frames []animFrame) error {
+	ew := &errWriter{w: w}
+	ew.Write([]byte("\x89PNG\r\n\x1a\n"))
+
+	seq := uint32(0)
+	for i, f := range frames {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, f.img); err != nil {
+			return err
+		}
+		chunks, err := pngChunks(buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			for _, c := range chunks {
+				if c.typ == "IHDR" {
+					writeChunk(ew, c.typ, c.data)
+				}
+			}
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl[0:], uint32(len(frames)))
+			binary.BigEndian.PutUint32(actl[4:], 0) // loop forever
+			writeChunk(ew, "acTL", actl)
+		}
+
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(f.img.Rect.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(f.img.Rect.Dy()))
+		binary.BigEndian.PutUint16(fctl[20:], uint16(math.Round(f.delay*1000)))
+		binary.BigEndian.PutUint16(fctl[22:], 1000)
+		seq++
+		writeChunk(ew, "fcTL", fctl)
+
+		for _, c := range chunks {
+			if c.typ != "IDAT" {
+				continue
+			}
+			if i == 0 {
+				writeChunk(ew, "IDAT", c.data)
+				continue
+			}
+			data := make([]byte, 4+len(c.data))
+			binary.BigEndian.PutUint32(data, seq)
+			copy(data[4:], c.data)
+			seq++
+			writeChunk(ew, "fdAT", data)
+		}
+	}
+	writeChunk(ew, "IEND", nil)
+	return ew.err
+}
+
+// pngChunk is a chunk of a PNG file
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// pngChunks splits an encoded PNG image into its chunks
+func pngChunks(n []byte) ([]pngChunk, error) {
+	if len(n) < 8 {
+		return nil, fmt.Errorf("invalid PNG data")
+	}
+	var chunks []pngChunk
+	for p := 8; p < len(n); {
+		if p+12 > len(n) {
+			return nil, fmt.Errorf("invalid PNG data")
+		}
+		l := int(binary.BigEndian.Uint32(n[p:]))
+		if p+12+l > len(n) {
+			return nil, fmt.Errorf("invalid PNG data")
+		}
+		chunks = append(chunks, pngChunk{string(n[p+4 : p+8]), n[p+8 : p+8+l]})
+		p += 12 + l
+	}
+	return chunks, nil
+}
+
+// writeChunk writes a PNG chunk, including its length and checksum
+func writeChunk(w io.Writer, typ string, data []byte) {
+	head := make([]byte, 8)
+	binary.BigEndian.PutUint32(head, uint32(len(data)))
+	copy(head[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(head[4:])
+	crc.Write(data)
+	w.Write(head)
+	w.Write(data)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// animateCommand handles "gofusion animate [flags] [recording]", which replays a recorded game
+// and writes it as animated GIF or PNG. Without a recording, the last game is used.
+func animateCommand(args []string) error {
+	fs := flag.NewFlagSet("animate", flag.ExitOnError)
+	output := fs.String("o", "game.gif", "output file (.gif or .png)")
+	size := fs.String("size", "400x400", "image size in pixels")
+	fps := fs.Float64("fps", 15, "frames per second")
+	samples := fs.Int("samples", 1, "samples per pixel in each direction (anti-aliasing)")
+	themeName := fs.String("theme", "", "theme to use (default: the current one)")
+	assetDir := fs.String("assets", "", "directory with assets overriding the built-in ones")
+	seed := fs.Int64("seed", 0, "seed of the game (instead of a recording file)")
+	moves := fs.String("moves", "", "moves of the game as letters L, R, U, D (instead of a recording file)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gofusion animate [flags] [recording]\n\n"+
+			"recording defaults to the last game played (%s)\n\n", lastGameFile())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var r Recording
+	if *moves != "" {
+		r = Recording{Seed: *seed, Moves: strings.ToUpper(*moves)}
+		if err := r.check(); err != nil {
+			return err
+		}
+	} else {
+		fileName := lastGameFile()
+		if fs.NArg() > 0 {
+			fileName = fs.Arg(0)
+		}
+		var err error
+		if r, err = readRecording(fileName); err != nil {
+			return err
+		}
+	}
+
+	width, height, err := parseSize(*size)
+	if err != nil {
+		return err
+	}
+	if *fps <= 0 {
+		return fmt.Errorf("invalid frame rate %v", *fps)
+	}
+	var write func(io.Writer, []animFrame) error
+	switch strings.ToLower(filepath.Ext(*output)) {
+	case ".gif":
+		write = writeGIF
+	case ".png", ".apng":
+		write = writeAPNG
+	default:
+		return fmt.Errorf("unsupported animation format %q", filepath.Ext(*output))
+	}
+
+	theme, cam, err := loadRenderTheme(*assetDir, *themeName)
+	if err != nil {
+		return err
+	}
+
+	anim := &gameAnimator{theme: theme, cam: cam, width: width, height: height, samples: *samples, fps: *fps}
+	if err := anim.animate(r); err != nil {
+		return err
+	}
+	err = writeFile(*output, func(w io.Writer) error {
+		return write(w, anim.frames)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s written (%d frames)\n", *output, len(anim.frames))
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// defaultAssets holds the files the game needs at runtime, so the binary can be started
+// from any directory without having to ship them alongside.
+//
+//go:embed gofusion.qml Button.qml particle.png model themes puzzles
+var defaultAssets embed.FS
+
+// Assets resolves the files used by the game (QML files, images and tile models).
+// Files present in the override directory take precedence over the defaults embedded
+// in the binary, so single files can be customized without touching the rest.
+type Assets struct {
+	overrideDir string
+
+	// directory holding the merged assets (created on demand by Root)
+	root string
+}
+
+// NewAssets creates an asset resolver. overrideDir may be empty.
+func NewAssets(overrideDir string) *Assets {
+	a := new(Assets)
+	a.overrideDir = overrideDir
+	return a
+}
+
+// Open opens the named asset. name is a slash-separated path relative to the asset root,
+// e.g. "model/tile_0002.obj".
+func (a *Assets) Open(name string) (io.ReadCloser, error) {
+	if a.overrideDir != "" {
+		f, err := os.Open(filepath.Join(a.overrideDir, filepath.FromSlash(name)))
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return defaultAssets.Open(name)
+}
+
+// Root returns a directory containing all assets, i.e. the defaults overlaid with the
+// content of the override directory. This is needed for consumers that can only work
+// with real files, like the QML engine, which resolves "Button.qml" and "particle.png"
+// relative to the directory of the main QML file.
+//
+// The directory is named after a hash of the assets, so processes using the same assets
+// share it and others get their own. It is never changed once complete, as other processes
+// may be loading files from it: it is prepared under a temporary name and then renamed.
+func (a *Assets) Root() (string, error) {
+	if a.root != "" {
+		return a.root, nil
+	}
+
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		cache = os.TempDir()
+	}
+	dir := filepath.Join(cache, "gofusion")
+	hash, err := a.hash()
+	if err != nil {
+		return "", fmt.Errorf("cannot read assets: %v", err)
+	}
+	root := filepath.Join(dir, "assets-"+hash)
+	if _, err := os.Stat(root); err == nil {
+		a.root = root
+		return root, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(dir, "tmp-assets-")
+	if err != nil {
+		return "", err
+	}
+	if err := a.extract(tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, root); err != nil {
+		os.RemoveAll(tmp)
+		// another process may have got there first
+		if _, serr := os.Stat(root); serr != nil {
+			return "", err
+		}
+	}
+
+	a.root = root
+	return root, nil
+}
+
+// extract writes the defaults, overlaid with the override directory, to dir
+func (a *Assets) extract(dir string) error {
+	if err := copyTree(defaultAssets, dir); err != nil {
+		return err
+	}
+	if a.overrideDir != "" {
+		if err := copyTree(os.DirFS(a.overrideDir), dir); err != nil {
+			return fmt.Errorf("cannot apply asset overrides from %s: %v", a.overrideDir, err)
+		}
+	}
+	return nil
+}
+
+// hash returns a hash of the names and contents of the default assets and the overrides
+func (a *Assets) hash() (string, error) {
+	h := sha256.New()
+	add := func(src fs.FS) error {
+		return fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			f, err := src.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			data, err := ioutil.ReadAll(f)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s %d\n", name, len(data))
+			h.Write(data)
+			return nil
+		})
+	}
+	if err := add(defaultAssets); err != nil {
+		return "", err
+	}
+	if a.overrideDir != "" {
+		h.Write([]byte("overrides\n"))
+		if err := add(os.DirFS(a.overrideDir)); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
+// Path returns the path of the named asset inside the directory returned by Root.
+func (a *Assets) Path(name string) (string, error) {
+	root, err := a.Root()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, filepath.FromSlash(name)), nil
+}
+
+// extractAssets writes the embedded default assets to dir.
+// Existing files are only overwritten if force is set.
+func extractAssets(dir string, force bool) error {
+	if !force {
+		err := fs.WalkDir(defaultAssets, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+				return fmt.Errorf("%s already exists (use -force to overwrite)", filepath.Join(dir, name))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return copyTree(defaultAssets, dir)
+}
+
+// copyTree copies all files from src to the directory dst, creating directories as needed
+func copyTree(src fs.FS, dst string) error {
+	return fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		in, err := src.Open(name)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// actions which can be bound to keys and gamepad buttons, in the order in which they are shown
+// on the bindings screen
+var actions = []struct {
+	name, label string
+}{
+	{"left", "Move left"},
+	{"right", "Move right"},
+	{"up", "Move up"},
+	{"down", "Move down"},
+	{"upleft", "Move up left"},
+	{"upright", "Move up right"},
+	{"downleft", "Move down left"},
+	{"downright", "Move down right"},
+	{"undo", "Undo"},
+	{"restart", "Restart"},
+	{"hint", "Hint"},
+	{"pause", "Pause"},
+	{"fullscreen", "Fullscreen"},
+	{"bindings", "Key bindings"},
+}
+
+// actionMoves maps the move actions to the letters used for the moves (see topology); the
+// diagonal moves are the ones of the hex board
+var actionMoves = map[string]byte{
+	"left":      'L',
+	"right":     'R',
+	"up":        'U',
+	"down":      'D',
+	"upleft":    'Q',
+	"upright":   'E',
+	"downleft":  'Z',
+	"downright": 'C',
+}
+
+// moveActions maps the letters of the moves to the corresponding actions
+var moveActions = map[byte]string{
+	'L': "left", 'R': "right", 'U': "up", 'D': "down",
+	'Q': "upleft", 'E': "upright", 'Z': "downleft", 'C': "downright",
+}
+
+// defaultBindings holds the keys and gamepad buttons of each action, unless set otherwise
+// in the settings
+var defaultBindings = map[string][]string{
+	"left":       {"Left", "A", "H", "PadLeft"},
+	"right":      {"Right", "D", "L", "PadRight"},
+	"up":         {"Up", "W", "K", "PadUp"},
+	"down":       {"Down", "S", "J", "PadDown"},
+	"upleft":     {"Q", "Home"},
+	"upright":    {"E", "PageUp"},
+	"downleft":   {"Z", "End"},
+	"downright":  {"C", "PageDown"},
+	"undo":       {"U", "Backspace", "PadB"},
+	"restart":    {"R", "PadSelect"},
+	"hint":       {"I", "PadY"},
+	"pause":      {"P", "Escape", "PadStart"},
+	"fullscreen": {"F11"},
+	"bindings":   {"F2"},
+}
+
+// keyNames maps the names of the special keys to their Qt key codes. Keys producing a printable
+// character are named by that character (letters in upper case), other keys as "Key<code>".
+var keyNames = map[string]int{
+	"Escape":    0x01000000,
+	"Tab":       0x01000001,
+	"Backspace": 0x01000003,
+	"Return":    0x01000004,
+	"Enter":     0x01000005,
+	"Insert":    0x01000006,
+	"Delete":    0x01000007,
+	"Pause":     0x01000008,
+	"Home":      0x01000010,
+	"End":       0x01000011,
+	"Left":      0x01000012,
+	"Up":        0x01000013,
+	"Right":     0x01000014,
+	"Down":      0x01000015,
+	"PageUp":    0x01000016,
+	"PageDown":  0x01000017,
+	"Space":     0x20,
+}
+
+func init() {
+	for i := 1; i <= 12; i++ {
+		keyNames["F"+strconv.Itoa(i)] = 0x01000030 + i - 1
+	}
+}
+
+// keyName returns the name of the key with the given Qt key code
+func keyName(code int) string {
+	for name, c := range keyNames {
+		if c == code {
+			return name
+		}
+	}
+	if code > 0x20 && code < 0x7f {
+		return string(rune(code))
+	}
+	return "Key" + strconv.Itoa(code)
+}
+
+// normalizeKey returns the canonical name of a key or gamepad button given in the settings,
+// e.g. "a" for "A" and "Key65" for "A" as well
+func normalizeKey(name string) (string, error) {
+	if _, ok := keyNames[name]; ok {
+		return name, nil
+	}
+	if _, ok := padButtons[name]; ok {
+		return name, nil
+	}
+	if len(name) == 1 && name[0] > 0x20 && name[0] < 0x7f {
+		return strings.ToUpper(name), nil
+	}
+	if strings.HasPrefix(name, "Key") {
+		if code, err := strconv.Atoi(name[3:]); err == nil {
+			return keyName(code), nil
+		}
+	}
+	return "", fmt.Errorf("unknown key %q", name)
+}
+
+// bindingTable holds the keys and buttons bound to each action, and the reverse mapping
+type bindingTable struct {
+	keys    map[string][]string // per action
+	actions map[string]string   // per key
+}
+
+// newBindingTable creates the table from the bindings in the settings; actions which are not
+// set there keep their default keys. Keys which are unknown, or bound twice, are reported.
+func newBindingTable(custom map[string][]string) (*bindingTable, []error) {
+	var errs []error
+	bt := &bindingTable{keys: make(map[string][]string), actions: make(map[string]string)}
+	for _, a := range actions {
+		keys, ok := custom[a.name]
+		if !ok {
+			keys = defaultBindings[a.name]
+		}
+		for _, k := range keys {
+			name, err := normalizeKey(k)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", a.name, err))
+				continue
+			}
+			if other, ok := bt.actions[name]; ok {
+				errs = append(errs, fmt.Errorf("%s: key %s is already bound to %s", a.name, name, other))
+				continue
+			}
+			bt.bind(a.name, name)
+		}
+	}
+	for name := range custom {
+		if _, ok := defaultBindings[name]; !ok {
+			errs = append(errs, fmt.Errorf("unknown action %q", name))
+		}
+	}
+	return bt, errs
+}
+
+// bind adds the key to the keys of the action, removing it from any other action
+func (bt *bindingTable) bind(action, key string) {
+	if old, ok := bt.actions[key]; ok {
+		keys := bt.keys[old][:0]
+		for _, k := range bt.keys[old] {
+			if k != key {
+				keys = append(keys, k)
+			}
+		}
+		bt.keys[old] = keys
+	}
+	bt.actions[key] = action
+	bt.keys[action] = append(bt.keys[action], key)
+}
+
+// unbind removes all keys of the action
+func (bt *bindingTable) unbind(action string) {
+	for _, k := range bt.keys[action] {
+		delete(bt.actions, k)
+	}
+	bt.keys[action] = nil
+}
+
+// settings returns the bindings in the form stored in the settings file
+func (bt *bindingTable) settings() map[string][]string {
+	m := make(map[string][]string)
+	for _, a := range actions {
+		m[a.name] = append([]string{}, bt.keys[a.name]...)
+	}
+	return m
+}
+
+// initBindings sets up the key bindings from the settings and starts reading the gamepad
+func (ctrl *Control) initBindings() {
+	var custom map[string][]string
+	device, device2 := "", ""
+	if ctrl.settings != nil {
+		custom = ctrl.settings.GetBindings()
+		device = ctrl.settings.GetGamepad()
+		device2 = ctrl.settings.GetGamepad2()
+	}
+	var errs []error
+	ctrl.bindings, errs = newBindingTable(custom)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "key bindings: %v\n", err)
+	}
+	if device != "off" {
+		if err := startGamepad(device, 0, ctrl.handleInput); err != nil {
+			fmt.Fprintf(os.Stderr, "gamepad: %v\n", err)
+		}
+	}
+	// the buttons of the second gamepad are named "Pad2Left" etc., see versusKeys
+	if device2 != "off" {
+		err := startGamepad(device2, 1, func(button string) {
+			ctrl.handleInput(strings.Replace(button, "Pad", "Pad2", 1))
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "second gamepad: %v\n", err)
+		}
+	}
+}
+
+// HandleKey handles keyboard events: while a key is being assigned on the bindings screen,
+// the key is bound to the action, otherwise the action bound to the key is dispatched
+func (ctrl *Control) HandleKey(key int) {
+	ctrl.handleInput(keyName(key))
+}
+
+// handleInput handles a key or gamepad button given by name
+func (ctrl *Control) handleInput(name string) {
+	if ctrl.capture != "" {
+		ctrl.captureKey(name)
+		return
+	}
+	if name == "Escape" && ctrl.BindingsScreen.Bool("visible") {
+		ctrl.showBindings(false)
+		return
+	}
+	if (ctrl.versus != nil || ctrl.online != nil) && ctrl.versusInput(name) {
+		return
+	}
+	if action, ok := ctrl.bindings.actions[name]; ok {
+		ctrl.dispatch(action)
+	}
+}
+
+// dispatch executes the named action
+func (ctrl *Control) dispatch(action string) {
+	// the main board is hidden during versus and online games
+	if (ctrl.versus != nil || ctrl.online != nil) && action != "restart" && action != "fullscreen" {
+		return
+	}
+	if _, ok := actionMoves[action]; ok {
+		if ctrl.paused || ctrl.editing || board.puzzle && ctrl.levelOver {
+			return
+		}
+		if !ctrl.Running {
+			ctrl.SetRunning(true)
+		}
+		ctrl.queueAction(action)
+		return
+	}
+	switch action {
+	case "undo":
+		if ctrl.daily != "" {
+			ctrl.SetMessage("No undo in the daily challenge", "")
+		} else if !ctrl.paused && !ctrl.editing {
+			ctrl.queueAction(action)
+		}
+	case "restart":
+		ctrl.HandleRestartButton()
+	case "hint":
+		if ctrl.daily != "" {
+			ctrl.SetMessage("No hints in the daily challenge", "")
+		} else if dir, ok := board.bestMove(); ok {
+			ctrl.SetMessage("Hint: "+strings.ToLower(actionLabel(moveActions[dir])), "")
+		} else {
+			ctrl.SetMessage("No more moves", "")
+		}
+	case "pause":
+		ctrl.setPaused(!ctrl.paused)
+	case "fullscreen":
+		ctrl.setFullscreen(!ctrl.fullscreen)
+	case "bindings":
+		ctrl.showBindings(!ctrl.BindingsScreen.Bool("visible"))
+	}
+}
+
+// actionLabel returns the label of the action shown to the user
+func actionLabel(action string) string {
+	for _, a := range actions {
+		if a.name == action {
+			return a.label
+		}
+	}
+	return action
+}
+
+// setPaused pauses or continues the game; moves are ignored while the game is paused
+func (ctrl *Control) setPaused(v bool) {
+	ctrl.paused = v
+	if v {
+		keys := ctrl.bindings.keys["pause"]
+		hint := ""
+		if len(keys) > 0 {
+			hint = "press " + keys[0] + " to continue"
+		}
+		ctrl.SetMessage("Paused", hint)
+	} else {
+		ctrl.SetMessage("", "")
+	}
+}
+
+// ### BINDINGS SCREEN ###
+
+// showBindings shows or hides the screen listing the key bindings
+func (ctrl *Control) showBindings(v bool) {
+	ctrl.capture = ""
+	ctrl.BindingsScreen.Set("prompt", "click an action to add a key or button")
+	ctrl.refreshBindings()
+	ctrl.BindingsScreen.Set("visible", v)
+}
+
+// refreshBindings makes the bindings screen show the current bindings
+func (ctrl *Control) refreshBindings() {
+	list := ctrl.BindingsScreen.ObjectByName("bindingsList")
+	list.Set("model", 0)
+	list.Set("model", len(actions))
+}
+
+// BindingLabel returns the label of the i-th action on the bindings screen
+func (ctrl *Control) BindingLabel(i int) string {
+	return actions[i].label
+}
+
+// BindingKeys returns the keys and buttons bound to the i-th action on the bindings screen
+func (ctrl *Control) BindingKeys(i int) string {
+	keys := ctrl.bindings.keys[actions[i].name]
+	if len(keys) == 0 {
+		return "-"
+	}
+	return strings.Join(keys, ", ")
+}
+
+// HandleBindingClicked starts assigning a key to the i-th action
+func (ctrl *Control) HandleBindingClicked(i int) {
+	ctrl.capture = actions[i].name
+	ctrl.BindingsScreen.Set("prompt", "press a key or button for '"+actions[i].label+"' (Delete: clear, Escape: cancel)")
+}
+
+// captureKey binds the key to the action selected on the bindings screen. Escape cancels,
+// Delete removes all keys of the action.
+func (ctrl *Control) captureKey(name string) {
+	switch name {
+	case "Escape":
+	case "Delete":
+		ctrl.bindings.unbind(ctrl.capture)
+	default:
+		ctrl.bindings.bind(ctrl.capture, name)
+	}
+	ctrl.capture = ""
+	ctrl.BindingsScreen.Set("prompt", "click an action to add a key or button")
+	ctrl.refreshBindings()
+	ctrl.saveBindings()
+}
+
+// HandleBindingsReset restores the default bindings
+func (ctrl *Control) HandleBindingsReset() {
+	ctrl.bindings, _ = newBindingTable(nil)
+	ctrl.capture = ""
+	ctrl.refreshBindings()
+	ctrl.saveBindings()
+}
+
+// HandleBindingsButton opens the bindings screen
+func (ctrl *Control) HandleBindingsButton() {
+	ctrl.showBindings(true)
+}
+
+// HandleBindingsClose closes the bindings screen
+func (ctrl *Control) HandleBindingsClose() {
+	ctrl.showBindings(false)
+}
+
+// saveBindings stores the bindings in the settings
+func (ctrl *Control) saveBindings() {
+	if ctrl.settings != nil {
+		ctrl.settings.SetBindings(ctrl.bindings.settings())
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"gopkg.in/qml.v1"
+	"gopkg.in/qml.v1/gl/2.0"
+)
+
+// BoardView renders all tiles, the board base and the tiles' shadows in one perspective scene.
+// The tiles themselves are plain QML items; BoardView only takes their (animated) position,
+// size and opacity and draws the corresponding model.
+type BoardView struct {
+	qml.Object
+
+	// the player whose board is shown in a versus game (1 or 2), or 0 for the main board
+	Player int
+
+	// created on the first paint, when the OpenGL context is available
+	renderer sceneRenderer
+}
+
+// shownBoard returns the board shown by the view (nil if there is none)
+func (v *BoardView) shownBoard() *Board {
+	if v.Player == 0 {
+		return &board
+	}
+	if ctrl.versus == nil {
+		return nil
+	}
+	return ctrl.versus.boards[v.Player-1]
+}
+
+// tileStates returns the current state of all tiles on the board, as shown by QML. The boards
+// of versus games are simulated, their tiles are shown at their fields without animation.
+func (v *BoardView) tileStates() []tileState {
+	var tiles []tileState
+	if v.Player != 0 {
+		if b := v.shownBoard(); b != nil {
+			for _, t := range b.tiles {
+				if t != nil {
+					tiles = append(tiles, b.tileState(t))
+				}
+			}
+		}
+		return tiles
+	}
+	l := ctrl.layout
+	for _, t := range board.tiles {
+		if t == nil {
+			continue
+		}
+		tiles = append(tiles, tileState{
+			x:        (float32(t.Float64("x")) - float32(l.x0)) / float32(l.grid),
+			y:        (float32(t.Float64("y")) - float32(l.y0)) / float32(l.grid),
+			scale:    float32(t.Float64("width")) / float32(l.tile),
+			alpha:    float32(t.Float64("opacity")),
+			nvalue:   t.displayValue(),
+			number:   board.mergeRule().number(t.displayValue()),
+			rotation: t.Rotation,
+			kind:     t.kind,
+		})
+	}
+	return tiles
+}
+
+// Paint draws the board and all tiles
+func (v *BoardView) Paint(p *qml.Painter) {
+	gl := GL.API(p)
+
+	width, height := float32(v.Int("width")), float32(v.Int("height"))
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	if v.renderer == nil {
+		v.renderer = newSceneRenderer(gl, ctrl.renderer)
+	}
+	w, h := float32(boardSize), float32(boardSize)
+	if b := v.shownBoard(); b != nil {
+		w, h = b.topology().extent()
+	}
+	sc := newScene(currentTheme, ctrl.camera, v.tileStates(), w, h, width/height)
+	v.renderer.paint(gl, sc)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command implements a subcommand of the gofusion binary (e.g. "gofusion assets extract").
+// args holds the command line arguments following the command name.
+type command func(args []string) error
+
+// commands maps the names of the available subcommands to their implementations.
+// Starting gofusion without a subcommand runs the game.
+var commands = map[string]command{
+	"assets":  assetsCommand,
+	"models":  modelsCommand,
+	"render":  renderCommand,
+	"animate": animateCommand,
+	"serve":   serveCommand,
+}
+
+// assetsCommand handles "gofusion assets extract [-force] [dir]", which writes the
+// embedded default assets to dir (default: current directory) as a starting point
+// for customization. Point the "-assets" flag or the AssetDir setting to the
+// directory afterwards to use the modified files.
+func assetsCommand(args []string) error {
+	if len(args) == 0 || args[0] != "extract" {
+		return fmt.Errorf("usage: gofusion assets extract [-force] [dir]")
+	}
+
+	fs := flag.NewFlagSet("assets extract", flag.ExitOnError)
+	force := fs.Bool("force", false, "overwrite existing files")
+	fs.Parse(args[1:])
+
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+	if err := extractAssets(dir, *force); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "default assets written to %s\n", dir)
+	return nil
+}
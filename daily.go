@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DailyResult is the result of the daily challenge of one day
+type DailyResult struct {
+	Date  string // UTC date, YYYY-MM-DD
+	Score int
+	Board string // the board at the end (see parseBoard)
+}
+
+// dailyDate returns the date of the daily challenge at time t; the challenge changes at
+// midnight UTC, at the same time for everyone
+func dailyDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// dailySeed returns the seed of the random tiles of the daily challenge of the given date,
+// so every player gets the same tiles
+func dailySeed(date string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("gofusion daily " + date))
+	return int64(h.Sum64())
+}
+
+// dailyEmoji shows the tiles on the shared result grid, by tile level
+var dailyEmoji = []string{"⬛", "⬜", "⬜", "🟨", "🟨", "🟧", "🟧", "🟥", "🟥", "🟪", "🟪", "🟦"}
+
+// shareText returns the result as text to share with others: the score and a grid of colored
+// squares summarizing the final board
+func (r DailyResult) shareText(streak int) string {
+	tiles, _, _, _ := parseBoard(r.Board)
+	grid := make([][]string, boardSize)
+	for y := range grid {
+		grid[y] = make([]string, boardSize)
+		for x := range grid[y] {
+			grid[y][x] = dailyEmoji[0]
+		}
+	}
+	best := 0
+	for _, t := range tiles {
+		level := t.nvalue
+		if level >= len(dailyEmoji) {
+			level = len(dailyEmoji) - 1
+		}
+		grid[int(t.y)][int(t.x)] = dailyEmoji[level]
+		if t.nvalue > best {
+			best = t.nvalue
+		}
+	}
+
+	lines := []string{
+		"GoFusion Daily " + r.Date,
+		"Score " + strconv.Itoa(r.Score) + ", best tile " + strconv.Itoa(1<<uint(best)),
+	}
+	if streak > 1 {
+		lines = append(lines, strconv.Itoa(streak)+" days in a row")
+	}
+	for _, row := range grid {
+		lines = append(lines, strings.Join(row, ""))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// HandleDailyButton starts the daily challenge. There is one scored attempt per day: it counts
+// as soon as it is started, and ends with the first game over (or win), or when another game
+// is started.
+func (ctrl *Control) HandleDailyButton() {
+	ctrl.LevelScreen.Set("visible", false)
+	if ctrl.settings == nil {
+		return
+	}
+	today := dailyDate(time.Now())
+	if last := ctrl.settings.GetDaily(); last != nil && last.Date == today {
+		ctrl.SetMessage("You have played today's challenge", "score "+strconv.Itoa(last.Score)+" - come back tomorrow")
+		return
+	}
+
+	ctrl.HandleVersusClose()
+	ctrl.saveLastGame()
+	ctrl.clearQueue()
+	ctrl.paused = false
+	ctrl.level = nil
+	if ctrl.editing {
+		ctrl.setEditing(false)
+	}
+	board.rule = ""
+	board.setHex(false)
+	board.newGame(dailySeed(today))
+
+	// the attempt is used up from now on
+	streak := 1
+	if last := ctrl.settings.GetDaily(); last != nil && last.Date == dailyDate(time.Now().AddDate(0, 0, -1)) {
+		streak = ctrl.settings.GetDailyStreak() + 1
+	}
+	ctrl.settings.SetDaily(DailyResult{Date: today, Board: board.layoutSpec()}, streak)
+	ctrl.daily = today
+
+	ctrl.Running = false
+	ctrl.SetMessage("Daily challenge", today)
+	ctrl.showScore()
+}
+
+// finishDaily stores the result of the daily challenge being played
+func (ctrl *Control) finishDaily() {
+	if ctrl.settings == nil {
+		return
+	}
+	r := DailyResult{Date: ctrl.daily, Score: board.score, Board: board.layoutSpec()}
+	ctrl.settings.SetDaily(r, ctrl.settings.GetDailyStreak())
+	if r.Score > ctrl.settings.GetDailyBest() {
+		ctrl.settings.SetDailyBest(r.Score)
+	}
+	ctrl.daily = ""
+}
+
+// showDailyResult shows the result at the end of the daily challenge
+func (ctrl *Control) showDailyResult() {
+	r := ctrl.settings.GetDaily()
+	sub := "best " + strconv.Itoa(ctrl.settings.GetDailyBest())
+	if streak := ctrl.settings.GetDailyStreak(); streak > 1 {
+		sub += ", " + strconv.Itoa(streak) + " days in a row"
+	}
+	ctrl.SetMessage("Daily challenge: "+strconv.Itoa(r.Score), sub)
+}
+
+// HandleShareButton copies the result of the last daily challenge to the clipboard, and writes
+// it to a text file in the user's home directory
+func (ctrl *Control) HandleShareButton() {
+	ctrl.LevelScreen.Set("visible", false)
+	var r *DailyResult
+	if ctrl.settings != nil {
+		r = ctrl.settings.GetDaily()
+	}
+	if r == nil || ctrl.daily != "" {
+		ctrl.SetMessage("Nothing to share", "finish a daily challenge first")
+		return
+	}
+	text := r.shareText(ctrl.settings.GetDailyStreak())
+	ctrl.Root.Call("copyToClipboard", text)
+
+	dir := "."
+	if u, err := user.Current(); err == nil {
+		dir = u.HomeDir
+	}
+	fileName := filepath.Join(dir, "gofusion-daily-"+r.Date+".txt")
+	if err := ioutil.WriteFile(fileName, []byte(text), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot save daily result: %v\n", err)
+		ctrl.SetMessage("Result copied to the clipboard", "")
+		return
+	}
+	ctrl.SetMessage("Result copied to the clipboard", fileName)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scenarios are built-in board layouts for testing (see parseBoard for the format)
+var scenarios = map[string]string{
+	// several pairs of tiles that can be merged, and a pair of 2048 tiles that cannot
+	"merge": "16,16,32,32/64,64,128,128/256,256,512,512/1024,1024,2048,2048",
+	// guaranteed to lead to "Game Over" after the next move
+	"gameover": "8,16,8,16/32,64,32,64/128,256,128,256/512,1024,512,0",
+}
+
+// scenarioNames returns the names of the built-in scenarios, for the usage message
+func scenarioNames() string {
+	var names []string
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// loadScenario returns the layout of the built-in scenario with the given name, or else
+// the one read from the layout file of that name
+func loadScenario(name string) (string, error) {
+	if layout, ok := scenarios[name]; ok {
+		return layout, nil
+	}
+	return readLayout(name)
+}
+
+// readLayout reads a board layout from a file, which holds the layout as given to
+// "gofusion render": rows separated by "/" or line breaks
+func readLayout(fileName string) (string, error) {
+	n, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	var rows []string
+	for _, line := range strings.Split(string(n), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			rows = append(rows, line)
+		}
+	}
+	layout := strings.Join(rows, "/")
+	if _, _, _, err := parseBoard(layout); err != nil {
+		return "", fmt.Errorf("%s: %v", fileName, err)
+	}
+	return layout, nil
+}
+
+// writeLayout writes a board layout to a file, one row per line
+func writeLayout(fileName, layout string) error {
+	return ioutil.WriteFile(fileName, []byte(strings.Replace(layout, "/", "\n", -1)+"\n"), 0644)
+}
+
+// layoutSpec returns the layout of the tiles on the board (see parseBoard)
+func (b *Board) layoutSpec() string {
+	rows := make([]string, b.height)
+	for y := range rows {
+		fields := make([]string, b.width)
+		for x := range fields {
+			fields[x] = "0"
+			if t := b.tileAt(x, y); t != nil && t.kind != tileNumber {
+				fields[x] = kindField(t.kind, t.Value())
+			} else if t != nil {
+				fields[x] = strconv.Itoa(1 << uint(t.Value()))
+			}
+		}
+		rows[y] = strings.Join(fields, ",")
+	}
+	return strings.Join(rows, "/")
+}
+
+// newGameFrom starts a game with the tiles of the given layout instead of two random ones
+// (with an empty layout, it is the same as newGame)
+func (b *Board) newGameFrom(seed int64, layout string) error {
+	if layout == "" {
+		b.newGame(seed)
+		return nil
+	}
+	tiles, w, h, err := parseBoard(layout)
+	if err != nil {
+		return err
+	}
+	if w != b.width || h != b.height {
+		return fmt.Errorf("layout is %dx%d instead of %dx%d", w, h, b.width, b.height)
+	}
+	for _, t := range tiles {
+		if !b.topology().contains(int(t.x), int(t.y)) {
+			return fmt.Errorf("layout has a tile at %d,%d, which is not on the board", int(t.x), int(t.y))
+		}
+	}
+	b.reset(seed)
+	b.start = layout
+	for _, t := range tiles {
+		b.addKindAt(int(t.x), int(t.y), t.nvalue, t.kind)
+	}
+	return nil
+}
+
+// ### EDITOR ###
+
+// HandleEditButton switches the board editor on or off. In the editor, clicking a field puts
+// a tile of the selected value there (or removes the tile); moves are not possible. The tiles
+// of the current game are the starting point for editing, but the game itself ends, including
+// a puzzle being played; the daily challenge can't be edited. Leaving the editor starts a game
+// from the edited layout like the play button, or a new game if the board has been cleared.
+func (ctrl *Control) HandleEditButton() {
+	if ctrl.editing {
+		if len(board.tiles) == board.freeSpaces(nil) {
+			ctrl.setEditing(false)
+			board.start = ""
+			ctrl.HandleRestartButton()
+			return
+		}
+		ctrl.HandleEditorPlay()
+		return
+	}
+	if ctrl.daily != "" {
+		ctrl.SetMessage("No editing in the daily challenge", "")
+		return
+	}
+	ctrl.saveLastGame()
+	ctrl.level = nil
+	ctrl.levelOver = false
+	ctrl.setEditing(true)
+}
+
+// setEditing switches the board editor on or off
+func (ctrl *Control) setEditing(v bool) {
+	ctrl.editing = v
+	ctrl.clearQueue()
+	ctrl.EditorPanel.Set("visible", v)
+	ctrl.EditorPanel.Set("brush", ctrl.brush)
+	if v {
+		ctrl.SetMessage("", "")
+	}
+}
+
+// HandleEditorBrush selects the value of the tiles placed by clicking (0 removes tiles)
+func (ctrl *Control) HandleEditorBrush(v int) {
+	ctrl.brush = v
+	ctrl.EditorPanel.Set("brush", v)
+}
+
+// editField puts a tile of the selected value on the field at the position x, y of the
+// board view, replacing the tile already there
+func (ctrl *Control) editField(x, y float64) {
+	if board.moved {
+		return
+	}
+	width, height := float32(ctrl.BoardView.Int("width")), float32(ctrl.BoardView.Int("height"))
+	if width <= 0 || height <= 0 {
+		return
+	}
+	bw, bh := board.topology().extent()
+	sc := newScene(currentTheme, ctrl.camera, nil, bw, bh, width/height)
+	fx, fy, ok := sc.fieldAt(float32(x), float32(y), width, height, board.topology())
+	if !ok {
+		return
+	}
+	if t := board.tileAt(fx, fy); t != nil {
+		board.removeTile(t)
+		t.destroy()
+	}
+	if ctrl.brush > 0 {
+		board.addTileAt(fx, fy, ctrl.brush)
+	}
+	ctrl.updateBoard()
+}
+
+// HandleEditorClear removes all tiles
+func (ctrl *Control) HandleEditorClear() {
+	board.clear()
+	ctrl.updateBoard()
+}
+
+// HandleEditorPlay starts a game from the edited layout
+func (ctrl *Control) HandleEditorPlay() {
+	layout := board.layoutSpec()
+	if len(board.tiles) == board.freeSpaces(nil) {
+		ctrl.SetMessage("The board is empty", "place some tiles first")
+		return
+	}
+	ctrl.setEditing(false)
+	ctrl.saveLastGame()
+	ctrl.level = nil
+	if err := board.newGameFrom(time.Now().UnixNano(), layout); err != nil {
+		ctrl.SetMessage("Cannot start game", err.Error())
+		return
+	}
+	ctrl.showScore()
+}
+
+// HandleEditorSave writes the layout to the file chosen in the save dialog
+func (ctrl *Control) HandleEditorSave(fileURL string) {
+	fileName, err := urlPath(fileURL)
+	if err == nil {
+		err = writeLayout(fileName, board.layoutSpec())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot save layout: %v\n", err)
+		ctrl.SetMessage("Save failed", err.Error())
+	}
+}
+
+// HandleEditorLoad puts the tiles of the layout file chosen in the open dialog on the board
+func (ctrl *Control) HandleEditorLoad(fileURL string) {
+	fileName, err := urlPath(fileURL)
+	var layout string
+	if err == nil {
+		layout, err = readLayout(fileName)
+	}
+	if err == nil {
+		ctrl.level = nil
+		err = board.newGameFrom(time.Now().UnixNano(), layout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot load layout: %v\n", err)
+		ctrl.SetMessage("Load failed", err.Error())
+	}
+	ctrl.showScore()
+}
+
+// urlPath returns the path of a file URL as returned by the QML file dialogs
+func urlPath(fileURL string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "" && u.Scheme != "file" {
+		return "", fmt.Errorf("not a local file: %s", fileURL)
+	}
+	return u.Path, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+// padButtons maps the names of the gamepad buttons to their Linux input event codes. The
+// directions are reported by the D-pad (as buttons or as hat axes) as well as the left stick.
+var padButtons = map[string]uint16{
+	"PadA":      0x130, // BTN_A
+	"PadB":      0x131, // BTN_B
+	"PadX":      0x133, // BTN_X
+	"PadY":      0x134, // BTN_Y
+	"PadL":      0x136, // BTN_TL
+	"PadR":      0x137, // BTN_TR
+	"PadSelect": 0x13a, // BTN_SELECT
+	"PadStart":  0x13b, // BTN_START
+	"PadMode":   0x13c, // BTN_MODE
+	"PadUp":     0x220, // BTN_DPAD_UP
+	"PadDown":   0x221, // BTN_DPAD_DOWN
+	"PadLeft":   0x222, // BTN_DPAD_LEFT
+	"PadRight":  0x223, // BTN_DPAD_RIGHT
+}
+
+// padButtonName returns the name of the gamepad button with the given event code
+func padButtonName(code uint16) string {
+	for name, c := range padButtons {
+		if c == code {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"gopkg.in/qml.v1"
+)
+
+// Linux input event types and axis codes (see linux/input-event-codes.h)
+const (
+	evKey   = 0x01
+	evAbs   = 0x03
+	absX    = 0x00
+	absY    = 0x01
+	absHat0 = 0x10 // ABS_HAT0X; ABS_HAT0Y follows
+)
+
+// inputEvent is a struct input_event as read from an evdev device
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// absInfo is a struct input_absinfo, describing the range of an axis
+type absInfo struct {
+	Value, Minimum, Maximum, Fuzz, Flat, Resolution int32
+}
+
+// startGamepad opens the evdev device of a gamepad and reports its buttons to handle, on the
+// GUI thread. Without a device, the index-th joystick found in /dev/input/by-id is used; having
+// no gamepad at all is not an error.
+func startGamepad(device string, index int, handle func(button string)) error {
+	if device == "" {
+		devices, _ := filepath.Glob("/dev/input/by-id/*-event-joystick")
+		if len(devices) <= index {
+			return nil
+		}
+		device = devices[index]
+	}
+	f, err := os.Open(device)
+	if err != nil {
+		return err
+	}
+	// the stick is optional, pads with only a D-pad have no axes
+	p := &gamepad{f: f, axes: make(map[uint16]absInfo)}
+	for _, axis := range []uint16{absX, absY} {
+		p.readAbsInfo(axis)
+	}
+	go p.run(func(button string) {
+		qml.RunMain(func() { handle(button) })
+	})
+	return nil
+}
+
+// gamepad reads the events of an evdev device and translates them to button presses
+type gamepad struct {
+	f *os.File
+
+	// range of the left stick's axes (if it has them), and the direction (-1, 0, 1) each axis of the stick and
+	// the D-pad hat currently points to; a direction is reported once when it is entered
+	axes map[uint16]absInfo
+	dir  map[uint16]int
+}
+
+// readAbsInfo gets the range of the axis with the EVIOCGABS ioctl. Axes the device doesn't
+// have (the ioctl fails or reports an empty range) are left out.
+func (p *gamepad) readAbsInfo(axis uint16) {
+	var info absInfo
+	req := uintptr(2<<30 | unsafe.Sizeof(info)<<16 | 'E'<<8 | uintptr(0x40+axis))
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, p.f.Fd(), req, uintptr(unsafe.Pointer(&info))); errno != 0 {
+		return
+	}
+	if info.Maximum > info.Minimum {
+		p.axes[axis] = info
+	}
+}
+
+// run reads events until the device is gone
+func (p *gamepad) run(press func(button string)) {
+	defer p.f.Close()
+	p.dir = make(map[uint16]int)
+	for {
+		var ev inputEvent
+		if err := binary.Read(p.f, binary.LittleEndian, &ev); err != nil {
+			fmt.Fprintf(os.Stderr, "gamepad: %v\n", err)
+			return
+		}
+		switch ev.Type {
+		case evKey:
+			// 1 is a press, 0 a release and 2 an auto repeat
+			if ev.Value == 1 {
+				if name := padButtonName(ev.Code); name != "" {
+					press(name)
+				}
+			}
+		case evAbs:
+			if name := p.axisMoved(ev.Code, ev.Value); name != "" {
+				press(name)
+			}
+		}
+	}
+}
+
+// axisMoved updates the direction of an axis and returns the name of the direction if the axis
+// has just been pushed into it
+func (p *gamepad) axisMoved(axis uint16, value int32) string {
+	d := 0
+	switch axis {
+	case absHat0, absHat0 + 1:
+		d = int(value)
+	case absX, absY:
+		info, ok := p.axes[axis]
+		if !ok {
+			return ""
+		}
+		center, half := (info.Minimum+info.Maximum)/2, (info.Maximum-info.Minimum)/2
+		// the stick has to be pushed at least half way
+		if value-center > half/2 {
+			d = 1
+		} else if center-value > half/2 {
+			d = -1
+		}
+	default:
+		return ""
+	}
+	if d == p.dir[axis] {
+		return ""
+	}
+	p.dir[axis] = d
+	horizontal := axis == absX || axis == absHat0
+	switch {
+	case d < 0 && horizontal:
+		return "PadLeft"
+	case d > 0 && horizontal:
+		return "PadRight"
+	case d < 0:
+		return "PadUp"
+	case d > 0:
+		return "PadDown"
+	}
+	return ""
+}
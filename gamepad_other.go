@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// startGamepad is only supported on Linux; without a device given there is nothing to report
+func startGamepad(device string, index int, handle func(button string)) error {
+	if device == "" {
+		return nil
+	}
+	return errors.New("gamepads are only supported on Linux")
+}
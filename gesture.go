@@ -0,0 +1,165 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// thresholds of the swipe recognizer at a sensitivity of 1, relative to the size of a tile
+const (
+	swipeMinDistance = 0.25 // a slow swipe has to cover a quarter of a tile...
+	swipeFlickSpeed  = 2.0  // ...a fast one (in tiles per second) only a third of that
+	swipeMaxRatio    = 0.5  // movement across the swipe direction, relative to the movement along it
+	swipeMaxDetour   = 1.5  // length of the path, relative to the distance from start to end
+	swipeFlickWindow = 100 * time.Millisecond
+)
+
+// pointerSample is one position of a pointer on its way over the screen
+type pointerSample struct {
+	x, y float64
+	t    time.Time
+}
+
+// swipe holds the path of one pointer (mouse or finger) from pressing to releasing it
+type swipe struct {
+	path []pointerSample
+}
+
+// swipeRecognizer turns pointer paths into moves in the directions of the board. The distance
+// and speed a swipe needs are scaled with the tile size and divided by the sensitivity.
+type swipeRecognizer struct {
+	tileSize    float64
+	sensitivity float64
+	topo        topology
+}
+
+// recognize returns the direction of the swipe (see topology), or 0 if the path is not
+// a swipe: too short and too slow, between two directions, or wandering about
+func (r swipeRecognizer) recognize(s *swipe) byte {
+	if len(s.path) < 2 || r.tileSize <= 0 {
+		return 0
+	}
+	sens := r.sensitivity
+	if sens <= 0 {
+		sens = 1
+	}
+	first, last := s.path[0], s.path[len(s.path)-1]
+	dx, dy := last.x-first.x, last.y-first.y
+
+	// the movement along the direction which fits best, and across it
+	var dir byte
+	major, minor := 0.0, 0.0
+	dirs := r.topo.directions()
+	for i := 0; i < len(dirs); i++ {
+		ux, uy := screenStep(r.topo, dirs[i])
+		if along := dx*ux + dy*uy; along > major {
+			dir, major, minor = dirs[i], along, math.Abs(dx*uy-dy*ux)
+		}
+	}
+	if major == 0 || minor > swipeMaxRatio*major {
+		return 0
+	}
+	length := 0.0
+	for i := 1; i < len(s.path); i++ {
+		length += math.Hypot(s.path[i].x-s.path[i-1].x, s.path[i].y-s.path[i-1].y)
+	}
+	if length > swipeMaxDetour*math.Hypot(dx, dy) {
+		return 0
+	}
+
+	minDistance := swipeMinDistance * r.tileSize / sens
+	if major < minDistance && (major < minDistance/3 || s.speed() < swipeFlickSpeed*r.tileSize/sens) {
+		return 0
+	}
+	return dir
+}
+
+// speed returns the speed of the pointer in pixels per second at the end of the swipe,
+// measured over the last swipeFlickWindow
+func (s *swipe) speed() float64 {
+	last := s.path[len(s.path)-1]
+	i := len(s.path) - 1
+	for i > 0 && last.t.Sub(s.path[i-1].t) <= swipeFlickWindow {
+		i--
+	}
+	if i == len(s.path)-1 {
+		i--
+	}
+	from := s.path[i]
+	dt := last.t.Sub(from.t).Seconds()
+	if dt <= 0 {
+		return 0
+	}
+	return math.Hypot(last.x-from.x, last.y-from.y) / dt
+}
+
+// recognizer returns the swipe recognizer for the current layout and settings
+func (ctrl *Control) recognizer() swipeRecognizer {
+	return swipeRecognizer{tileSize: float64(ctrl.layout.tile), sensitivity: ctrl.swipeSensitivity, topo: board.topology()}
+}
+
+// HandlePointerDown is called when a mouse button or a finger is pressed; id identifies the
+// touch point
+func (ctrl *Control) HandlePointerDown(id int, x, y float64) {
+	if !ctrl.Running && !ctrl.paused {
+		ctrl.SetRunning(true)
+	}
+	if ctrl.swipes == nil {
+		ctrl.swipes = make(map[int]*swipe)
+	}
+	if len(ctrl.swipes) == 0 {
+		ctrl.swipeDir = 0
+	}
+	ctrl.swipes[id] = &swipe{path: []pointerSample{{x, y, time.Now()}}}
+}
+
+// HandlePointerMove is called when a pressed pointer moves
+func (ctrl *Control) HandlePointerMove(id int, x, y float64) {
+	if s, ok := ctrl.swipes[id]; ok {
+		s.path = append(s.path, pointerSample{x, y, time.Now()})
+	}
+}
+
+// HandlePointerUp is called when a pointer is released. Swipes with several fingers make one
+// move when the last finger is lifted, if all fingers have been swiped in the same direction.
+func (ctrl *Control) HandlePointerUp(id int, x, y float64) {
+	s, ok := ctrl.swipes[id]
+	if !ok {
+		return
+	}
+	s.path = append(s.path, pointerSample{x, y, time.Now()})
+	delete(ctrl.swipes, id)
+
+	// the editor takes clicks instead of swipes
+	if ctrl.editing {
+		ctrl.editField(x-float64(ctrl.BoardView.Int("x")), y-float64(ctrl.BoardView.Int("y")))
+		return
+	}
+
+	if dir := ctrl.finishSwipe(ctrl.recognizer().recognize(s)); dir != 0 {
+		ctrl.dispatch(moveActions[dir])
+	}
+}
+
+// finishSwipe adds the direction a released pointer has been swiped in (0: none) to the swipe
+// of all pointers. When the last pointer has been released, it returns the direction of the
+// move to make, or 0 if there is none.
+func (ctrl *Control) finishSwipe(dir byte) byte {
+	switch {
+	case ctrl.swipeDir == 0:
+		ctrl.swipeDir = int(dir)
+	case dir != 0 && int(dir) != ctrl.swipeDir:
+		// fingers swiped in different directions
+		ctrl.swipeDir = -1
+	}
+	if len(ctrl.swipes) == 0 && ctrl.swipeDir > 0 {
+		return byte(ctrl.swipeDir)
+	}
+	return 0
+}
+
+// HandlePointerCancel is called when the system takes over a pointer, e.g. for its own gestures
+func (ctrl *Control) HandlePointerCancel(id int) {
+	delete(ctrl.swipes, id)
+	ctrl.swipeDir = -1
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// trace turns recorded pointer samples (x, y in pixels, time in milliseconds) into a swipe
+func trace(samples ...[3]float64) *swipe {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := &swipe{}
+	for _, p := range samples {
+		s.path = append(s.path, pointerSample{p[0], p[1], start.Add(time.Duration(p[2] * float64(time.Millisecond)))})
+	}
+	return s
+}
+
+var testGrid = gridTopology{w: boardSize, h: boardSize}
+
+func TestRecognizeSwipes(t *testing.T) {
+	tests := []struct {
+		name        string
+		tileSize    float64
+		sensitivity float64
+		topo        topology
+		swipe       *swipe
+		want        byte
+	}{
+		// clean swipes over a good part of a tile
+		{"right", 100, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{30, 2, 50}, [3]float64{80, 4, 100}, [3]float64{120, 5, 150}), 'R'},
+		{"left", 100, 1, testGrid, trace([3]float64{300, 200, 0}, [3]float64{260, 203, 60}, [3]float64{190, 204, 120}), 'L'},
+		{"up", 100, 1, testGrid, trace([3]float64{50, 400, 0}, [3]float64{48, 360, 40}, [3]float64{47, 310, 90}), 'U'},
+		{"down", 100, 1, testGrid, trace([3]float64{50, 0, 0}, [3]float64{55, 45, 70}, [3]float64{58, 90, 140}), 'D'},
+		{"slightly slanted", 100, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{30, 12, 50}, [3]float64{60, 25, 100}), 'R'},
+
+		// diagonals are ambiguous, paths wandering about aren't swipes
+		{"diagonal", 100, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{30, 28, 50}, [3]float64{60, 55, 100}), 0},
+		{"diagonal up", 100, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{-40, -40, 80}), 0},
+		{"back and forth", 100, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{100, 0, 100}, [3]float64{20, 0, 200}, [3]float64{60, 0, 300}), 0},
+		{"tap", 100, 1, testGrid, trace([3]float64{10, 10, 0}, [3]float64{10, 10, 80}), 0},
+		{"single sample", 100, 1, testGrid, trace([3]float64{10, 10, 0}), 0},
+
+		// short swipes need to be flicks
+		{"slow drag", 100, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{10, 0, 500}, [3]float64{20, 0, 1000}), 0},
+		{"flick", 100, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{6, 0, 20}, [3]float64{12, 0, 40}), 'R'},
+		{"flick too short", 100, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{4, 0, 10}, [3]float64{8, 0, 20}), 0},
+		{"flick slowing down", 100, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{12, 0, 40}, [3]float64{13, 0, 140}, [3]float64{14, 0, 240}), 0},
+
+		// the thresholds scale with the tile size and the sensitivity
+		{"slow drag on small tiles", 60, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{10, 0, 500}, [3]float64{20, 0, 1000}), 'R'},
+		{"drag on large tiles", 200, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{15, 0, 500}, [3]float64{30, 0, 1000}), 0},
+		{"drag on large tiles, far enough", 200, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{30, 0, 500}, [3]float64{60, 0, 1000}), 'R'},
+		{"slow drag, sensitive", 100, 2, testGrid, trace([3]float64{0, 0, 0}, [3]float64{10, 0, 500}, [3]float64{20, 0, 1000}), 'R'},
+		{"drag, insensitive", 100, 0.5, testGrid, trace([3]float64{0, 0, 0}, [3]float64{20, 0, 500}, [3]float64{40, 0, 1000}), 0},
+		{"no tile size", 0, 1, testGrid, trace([3]float64{0, 0, 0}, [3]float64{100, 0, 100}), 0},
+
+		// the six directions of the hex board
+		{"hex right", 100, 1, hexTopology{radius: hexRadius}, trace([3]float64{0, 0, 0}, [3]float64{60, 1, 100}), 'R'},
+		{"hex left", 100, 1, hexTopology{radius: hexRadius}, trace([3]float64{0, 0, 0}, [3]float64{-60, -1, 100}), 'L'},
+		{"hex up right", 100, 1, hexTopology{radius: hexRadius}, trace([3]float64{0, 0, 0}, [3]float64{30, -52, 100}), 'E'},
+		{"hex up left", 100, 1, hexTopology{radius: hexRadius}, trace([3]float64{0, 0, 0}, [3]float64{-30, -52, 100}), 'Q'},
+		{"hex down left", 100, 1, hexTopology{radius: hexRadius}, trace([3]float64{0, 0, 0}, [3]float64{-30, 52, 100}), 'Z'},
+		{"hex down right", 100, 1, hexTopology{radius: hexRadius}, trace([3]float64{0, 0, 0}, [3]float64{30, 52, 100}), 'C'},
+		{"hex straight up", 100, 1, hexTopology{radius: hexRadius}, trace([3]float64{0, 0, 0}, [3]float64{0, -60, 100}), 0},
+	}
+	for _, test := range tests {
+		r := swipeRecognizer{tileSize: test.tileSize, sensitivity: test.sensitivity, topo: test.topo}
+		if got := r.recognize(test.swipe); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMultiTouchSwipes(t *testing.T) {
+	right := func(y float64) *swipe {
+		return trace([3]float64{0, y, 0}, [3]float64{40, y + 2, 60}, [3]float64{90, y + 3, 120})
+	}
+	up := trace([3]float64{0, 300, 0}, [3]float64{1, 240, 60}, [3]float64{2, 180, 120})
+	tap := trace([3]float64{200, 200, 0}, [3]float64{200, 201, 100})
+
+	tests := []struct {
+		name    string
+		fingers []*swipe // in the order they are lifted
+		cancel  bool     // the system takes over the first finger instead
+		want    byte
+	}{
+		{"one finger", []*swipe{right(0)}, false, 'R'},
+		{"two fingers", []*swipe{right(0), right(100)}, false, 'R'},
+		{"three fingers", []*swipe{right(0), right(100), right(200)}, false, 'R'},
+		{"different directions", []*swipe{right(0), up}, false, 0},
+		{"resting finger", []*swipe{tap, right(100)}, false, 'R'},
+		{"resting finger lifted last", []*swipe{right(0), tap}, false, 'R'},
+		{"taps", []*swipe{tap, tap}, false, 0},
+		{"cancelled", []*swipe{right(0), right(100)}, true, 0},
+	}
+	r := swipeRecognizer{tileSize: 100, sensitivity: 1, topo: testGrid}
+	for _, test := range tests {
+		ctrl := &Control{swipes: make(map[int]*swipe)}
+		for id, s := range test.fingers {
+			ctrl.swipes[id] = s
+		}
+		var moves []byte
+		for id, s := range test.fingers {
+			if test.cancel && id == 0 {
+				ctrl.HandlePointerCancel(id)
+				continue
+			}
+			delete(ctrl.swipes, id)
+			if dir := ctrl.finishSwipe(r.recognize(s)); dir != 0 {
+				moves = append(moves, dir)
+			}
+		}
+		switch {
+		case test.want == 0 && len(moves) > 0:
+			t.Errorf("%s: got moves %q, want none", test.name, moves)
+		case test.want != 0 && (len(moves) != 1 || moves[0] != test.want):
+			t.Errorf("%s: got moves %q, want %q", test.name, moves, []byte{test.want})
+		}
+	}
+}
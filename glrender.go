@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/qml.v1/gl/2.0"
+	"gopkg.in/qml.v1/gl/glbase"
+)
+
+// sceneRenderer draws a scene with OpenGL. BoardView uses the shader-based renderer if it can
+// be set up, and the fixed-function one otherwise (or if selected in the settings).
+type sceneRenderer interface {
+	paint(gl *GL.GL, sc *scene)
+}
+
+// newSceneRenderer creates the renderer selected by name ("shader" or "fixed"),
+// falling back to the fixed-function renderer if the shaders can't be set up
+func newSceneRenderer(gl *GL.GL, name string) sceneRenderer {
+	if name == "fixed" {
+		return fixedRenderer{}
+	}
+	r, err := newShaderRenderer(gl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot use shader renderer, falling back to fixed-function pipeline: %v\n", err)
+		return fixedRenderer{}
+	}
+	return r
+}
+
+// ### FIXED-FUNCTION RENDERER ###
+
+// fixedRenderer draws the scene with the OpenGL 2.0 fixed-function pipeline
+// (matrix stack, GL lighting and client-side vertex arrays)
+type fixedRenderer struct{}
+
+// paint draws the board base, the shadows and the tiles
+func (r fixedRenderer) paint(gl *GL.GL, sc *scene) {
+	// set up perspective projection, saving the matrices set up by QML
+	gl.MatrixMode(GL.PROJECTION)
+	gl.PushMatrix()
+	gl.LoadMatrixf(sc.proj[:])
+	gl.MatrixMode(GL.MODELVIEW)
+	gl.PushMatrix()
+
+	gl.Enable(GL.BLEND)
+	gl.BlendFunc(GL.SRC_ALPHA, GL.ONE_MINUS_SRC_ALPHA)
+	gl.ShadeModel(GL.SMOOTH)
+	gl.Enable(GL.DEPTH_TEST)
+	gl.DepthMask(true)
+	gl.Enable(GL.NORMALIZE)
+	gl.Clear(GL.DEPTH_BUFFER_BIT | GL.STENCIL_BUFFER_BIT)
+
+	gl.LoadMatrixf(sc.view[:])
+	gl.Enable(GL.LIGHTING)
+	gl.Lightfv(GL.LIGHT0, GL.POSITION, sc.light[:])
+	gl.Enable(GL.LIGHT0)
+	gl.Disable(GL.COLOR_MATERIAL)
+	gl.EnableClientState(GL.NORMAL_ARRAY)
+	gl.EnableClientState(GL.VERTEX_ARRAY)
+
+	r.drawItem(gl, sc, sc.base)
+
+	// shadows are drawn onto the base before the tiles, so the tiles cover them; the stencil
+	// buffer makes sure every pixel is only darkened once
+	gl.Disable(GL.LIGHTING)
+	gl.DepthMask(false)
+	gl.Enable(GL.STENCIL_TEST)
+	gl.StencilFunc(GL.EQUAL, 0, 0xff)
+	gl.StencilOp(GL.KEEP, GL.KEEP, GL.INCR)
+	gl.DisableClientState(GL.NORMAL_ARRAY)
+	gl.Color4f(shadowColor[0], shadowColor[1], shadowColor[2], shadowColor[3])
+	for _, it := range sc.items {
+		m := sc.view.mul(sc.shadow).mul(it.model)
+		gl.LoadMatrixf(m[:])
+		gl.VertexPointer(3, GL.FLOAT, 0, it.group.Vertexes)
+		gl.DrawArrays(GL.TRIANGLES, 0, len(it.group.Vertexes)/3)
+	}
+	gl.Disable(GL.STENCIL_TEST)
+	gl.EnableClientState(GL.NORMAL_ARRAY)
+	gl.Enable(GL.LIGHTING)
+	gl.DepthMask(true)
+
+	for i, it := range sc.items {
+		// transparent tiles don't hide what's behind them
+		if i == sc.transparent {
+			gl.DepthMask(false)
+		}
+		r.drawItem(gl, sc, it)
+	}
+	gl.DepthMask(true)
+
+	gl.Enable(GL.COLOR_MATERIAL)
+
+	// restore the matrices for QML
+	gl.MatrixMode(GL.PROJECTION)
+	gl.PopMatrix()
+	gl.MatrixMode(GL.MODELVIEW)
+	gl.PopMatrix()
+}
+
+// drawItem draws the triangles of a group with its transformation, light and material
+func (r fixedRenderer) drawItem(gl *GL.GL, sc *scene, it *drawItem) {
+	modelView := sc.view.mul(it.model)
+	gl.LoadMatrixf(modelView[:])
+	gl.Lightfv(GL.LIGHT0, GL.SPECULAR, it.light)
+	gl.Materialfv(GL.FRONT_AND_BACK, GL.AMBIENT, it.ambient)
+	gl.Materialfv(GL.FRONT_AND_BACK, GL.DIFFUSE, it.diffuse)
+	gl.Materialfv(GL.FRONT_AND_BACK, GL.SPECULAR, it.specular)
+	gl.Materialf(GL.FRONT_AND_BACK, GL.SHININESS, it.shininess)
+	gl.VertexPointer(3, GL.FLOAT, 0, it.group.Vertexes)
+	gl.NormalPointer(GL.FLOAT, 0, it.group.Normals)
+	gl.DrawArrays(GL.TRIANGLES, 0, len(it.group.Vertexes)/3)
+}
+
+// ### SHADER RENDERER ###
+
+// vertexShader transforms the vertexes and passes position and normal in eye coordinates
+// on to the fragment shader
+const vertexShader = `
+attribute vec3 position;
+attribute vec3 normal;
+
+uniform mat4 modelView;
+uniform mat4 projection;
+
+varying vec3 eyePosition;
+varying vec3 eyeNormal;
+
+void main() {
+	vec4 p = modelView * vec4(position, 1.0);
+	eyePosition = p.xyz / p.w;
+	eyeNormal = (modelView * vec4(normal, 0.0)).xyz;
+	gl_Position = projection * p;
+}
+`
+
+// fragmentShader computes Blinn-Phong lighting per fragment, with the same light and material
+// model as the fixed-function pipeline (one point light, non-local viewer), or just uses the
+// given color if lighting is off
+const fragmentShader = `
+#ifdef GL_ES
+precision mediump float;
+#endif
+
+uniform bool lighting;
+uniform vec4 color;
+
+uniform vec3 lightPosition;
+uniform vec4 lightSpecular;
+uniform float globalAmbient;
+
+uniform vec4 ambient;
+uniform vec4 diffuse;
+uniform vec4 specular;
+uniform float shininess;
+
+varying vec3 eyePosition;
+varying vec3 eyeNormal;
+
+void main() {
+	if (!lighting) {
+		gl_FragColor = color;
+		return;
+	}
+	vec3 n = normalize(eyeNormal);
+	vec3 l = normalize(lightPosition - eyePosition);
+	float d = max(dot(n, l), 0.0);
+	float s = 0.0;
+	if (d > 0.0) {
+		float nh = max(dot(n, normalize(l + vec3(0.0, 0.0, 1.0))), 0.0);
+		if (nh > 0.0) {
+			s = pow(nh, shininess);
+		}
+	}
+	vec3 c = ambient.rgb * globalAmbient + diffuse.rgb * d + specular.rgb * lightSpecular.rgb * s;
+	gl_FragColor = vec4(clamp(c, 0.0, 1.0), diffuse.a);
+}
+`
+
+// meshBuffers are the vertex buffer objects holding a group
+type meshBuffers struct {
+	vertexes glbase.Buffer
+	normals  glbase.Buffer
+	count    int // number of vertexes
+}
+
+// shaderRenderer draws the scene with GLSL shaders. The groups are uploaded into vertex buffer
+// objects once and kept until the theme changes, as the models of all tile values are drawn
+// again and again while playing.
+type shaderRenderer struct {
+	program glbase.Program
+
+	position, normal glbase.Attrib
+	uniforms         map[string]glbase.Uniform
+
+	theme  *Theme // theme of the scenes the meshes have been uploaded for
+	meshes map[*Group]*meshBuffers
+}
+
+// newShaderRenderer compiles and links the shaders
+func newShaderRenderer(gl *GL.GL) (*shaderRenderer, error) {
+	vs, err := compileShader(gl, GL.VERTEX_SHADER, vertexShader)
+	if err != nil {
+		return nil, fmt.Errorf("vertex shader: %v", err)
+	}
+	defer gl.DeleteShader(vs)
+	fs, err := compileShader(gl, GL.FRAGMENT_SHADER, fragmentShader)
+	if err != nil {
+		return nil, fmt.Errorf("fragment shader: %v", err)
+	}
+	defer gl.DeleteShader(fs)
+
+	program := gl.CreateProgram()
+	gl.AttachShader(program, vs)
+	gl.AttachShader(program, fs)
+	gl.LinkProgram(program)
+	status := make([]int32, 1)
+	gl.GetProgramiv(program, GL.LINK_STATUS, status)
+	if status[0] == 0 {
+		log := gl.GetProgramInfoLog(program)
+		gl.DeleteProgram(program)
+		return nil, fmt.Errorf("cannot link shaders: %s", log)
+	}
+
+	r := &shaderRenderer{
+		program:  program,
+		position: gl.GetAttribLocation(program, "position"),
+		normal:   gl.GetAttribLocation(program, "normal"),
+		uniforms: make(map[string]glbase.Uniform),
+		meshes:   make(map[*Group]*meshBuffers),
+	}
+	for _, name := range []string{"modelView", "projection", "lighting", "color", "lightPosition",
+		"lightSpecular", "globalAmbient", "ambient", "diffuse", "specular", "shininess"} {
+		r.uniforms[name] = gl.GetUniformLocation(program, name)
+	}
+	return r, nil
+}
+
+// compileShader compiles a shader of the given type
+func compileShader(gl *GL.GL, typ glbase.Enum, source string) (glbase.Shader, error) {
+	shader := gl.CreateShader(typ)
+	gl.ShaderSource(shader, source)
+	gl.CompileShader(shader)
+	status := make([]int32, 1)
+	gl.GetShaderiv(shader, GL.COMPILE_STATUS, status)
+	if status[0] == 0 {
+		log := gl.GetShaderInfoLog(shader)
+		gl.DeleteShader(shader)
+		return 0, fmt.Errorf("%s", log)
+	}
+	return shader, nil
+}
+
+// mesh returns the vertex buffers of a group, uploading it if necessary
+func (r *shaderRenderer) mesh(gl *GL.GL, g *Group) *meshBuffers {
+	m, ok := r.meshes[g]
+	if !ok {
+		buffers := gl.GenBuffers(2)
+		m = &meshBuffers{vertexes: buffers[0], normals: buffers[1], count: len(g.Vertexes) / 3}
+		gl.BindBuffer(GL.ARRAY_BUFFER, m.vertexes)
+		gl.BufferData(GL.ARRAY_BUFFER, len(g.Vertexes)*4, g.Vertexes, GL.STATIC_DRAW)
+		gl.BindBuffer(GL.ARRAY_BUFFER, m.normals)
+		gl.BufferData(GL.ARRAY_BUFFER, len(g.Normals)*4, g.Normals, GL.STATIC_DRAW)
+		r.meshes[g] = m
+	}
+	return m
+}
+
+// paint draws the board base, the shadows and the tiles
+func (r *shaderRenderer) paint(gl *GL.GL, sc *scene) {
+	// free the buffers of the previous theme's models
+	if sc.theme != r.theme {
+		for g, m := range r.meshes {
+			gl.DeleteBuffers([]glbase.Buffer{m.vertexes, m.normals})
+			delete(r.meshes, g)
+		}
+		r.theme = sc.theme
+	}
+
+	gl.UseProgram(r.program)
+	gl.UniformMatrix4fv(r.uniforms["projection"], false, sc.proj[:])
+	light := sc.view.transformPoint([3]float32{sc.light[0], sc.light[1], sc.light[2]})
+	gl.Uniform3fv(r.uniforms["lightPosition"], light[:])
+	gl.Uniform1f(r.uniforms["globalAmbient"], globalAmbient)
+
+	gl.Enable(GL.BLEND)
+	gl.BlendFunc(GL.SRC_ALPHA, GL.ONE_MINUS_SRC_ALPHA)
+	gl.Enable(GL.DEPTH_TEST)
+	gl.DepthMask(true)
+	gl.Clear(GL.DEPTH_BUFFER_BIT | GL.STENCIL_BUFFER_BIT)
+	gl.EnableVertexAttribArray(r.position)
+	gl.EnableVertexAttribArray(r.normal)
+
+	gl.Uniform1i(r.uniforms["lighting"], 1)
+	r.drawItem(gl, sc.view.mul(sc.base.model), sc.base)
+
+	// shadows, see fixedRenderer.paint
+	gl.Uniform1i(r.uniforms["lighting"], 0)
+	gl.Uniform4fv(r.uniforms["color"], shadowColor)
+	gl.DepthMask(false)
+	gl.Enable(GL.STENCIL_TEST)
+	gl.StencilFunc(GL.EQUAL, 0, 0xff)
+	gl.StencilOp(GL.KEEP, GL.KEEP, GL.INCR)
+	for _, it := range sc.items {
+		r.drawItem(gl, sc.view.mul(sc.shadow).mul(it.model), it)
+	}
+	gl.Disable(GL.STENCIL_TEST)
+	gl.DepthMask(true)
+
+	gl.Uniform1i(r.uniforms["lighting"], 1)
+	for i, it := range sc.items {
+		if i == sc.transparent {
+			gl.DepthMask(false)
+		}
+		r.drawItem(gl, sc.view.mul(it.model), it)
+	}
+	gl.DepthMask(true)
+
+	// leave the state as QML expects it
+	gl.DisableVertexAttribArray(r.position)
+	gl.DisableVertexAttribArray(r.normal)
+	gl.BindBuffer(GL.ARRAY_BUFFER, 0)
+	gl.UseProgram(0)
+}
+
+// drawItem draws the triangles of a group with the given model-view matrix and its light
+// and material
+func (r *shaderRenderer) drawItem(gl *GL.GL, modelView mat4, it *drawItem) {
+	m := r.mesh(gl, it.group)
+	gl.UniformMatrix4fv(r.uniforms["modelView"], false, modelView[:])
+	gl.Uniform4fv(r.uniforms["lightSpecular"], it.light)
+	gl.Uniform4fv(r.uniforms["ambient"], it.ambient)
+	gl.Uniform4fv(r.uniforms["diffuse"], it.diffuse)
+	gl.Uniform4fv(r.uniforms["specular"], it.specular)
+	gl.Uniform1f(r.uniforms["shininess"], it.shininess)
+
+	gl.BindBuffer(GL.ARRAY_BUFFER, m.vertexes)
+	gl.VertexAttribPointer(r.position, 3, GL.FLOAT, false, 0, 0)
+	gl.BindBuffer(GL.ARRAY_BUFFER, m.normals)
+	gl.VertexAttribPointer(r.normal, 3, GL.FLOAT, false, 0, 0)
+	gl.DrawArrays(GL.TRIANGLES, 0, m.count)
+}
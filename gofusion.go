@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"math/rand"
 	"os"
@@ -10,20 +11,15 @@ import (
 	"time"
 
 	"gopkg.in/qml.v1"
-	"gopkg.in/qml.v1/gl/2.0"
 )
 
 /*
 
 TODO:
-- swipe gesture support
 - high score webservice (hack proof, DOS proof)
-- "real" 3D (perspective projection, all tiles in same scene graph -> Qt3D ?)
 
 */
 
-const tileSize int = 150
-const gridSize int = 150
 const boardSize int = 4
 const maxTileValue int = 11
 
@@ -36,16 +32,53 @@ var randGen = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 // Board contains all the tiles present on the board and methods to manipulate them.
 // Note that tiles is not a grid (two-dimensional array) holding the tiles, but a one-dimensional
-// array; the tiles themselves hold their position on the board. This allows us to have two tiles
-// at the same position (temporarily, before they are "fused").
+// slice with room for one tile per cell; the tiles themselves hold their position on the board.
+// This allows us to have two tiles at the same position (temporarily, before they are "fused").
 type Board struct {
-	tiles [boardSize * boardSize]*Tile
+	tiles []*Tile
 
+	// size of the board, or of the box around the hex board (see topology)
 	width  int
 	height int
+	hex    bool
 
 	// has a tile actually moved during the last move?
 	moved bool
+
+	// score of the current game
+	score int
+
+	// values of the tiles created by the merges of the last move
+	merges []int
+
+	// some of the random tiles are special tiles (see addRandomSpecialTile)
+	specials bool
+
+	// merge rule of the game (see mergeRules); unlike the other settings of the game it is
+	// kept by reset, since the first tiles already depend on it
+	rule string
+
+	// random tiles are taken from rand, which is seeded with seed at the start of each game,
+	// so the game can be replayed from the seed and the moves (see Recording)
+	seed  int64
+	rand  *rand.Rand
+	moves []byte
+
+	// layout the game started from (see parseBoard), or "" for two random tiles
+	start string
+
+	// in puzzles, tiles are added from a fixed sequence instead of randomly (see spawnTile)
+	puzzle    bool
+	spawns    []Spawn
+	nextSpawn int
+
+	// in versus games, random tiles are placed independently of the tiles on the board, so
+	// boards started with the same seed get the same tiles (see spawnTile)
+	shared bool
+
+	// the controller displaying the board, or nil if the board is only simulated
+	// (e.g. when replaying a recorded game)
+	ctrl *Control
 }
 
 // freeSpaces counts the number of free spaces present on the board
@@ -97,87 +130,51 @@ func (b *Board) tileAt(x, y int) *Tile {
 	return nil
 }
 
-// addRandomTile generates a random tile and
+// addRandomTile generates a random tile (its value given by the merge rule) and
 // puts it on the board
-func (b *Board) addRandomTile(maxValue int) {
-	v := randGen.Intn(maxValue) + 1
+func (b *Board) addRandomTile() *Tile {
+	v := b.mergeRule().spawn(b.rand)
 	x, y := 0, 0
 	// this is a very simple-minded approach,
 	// but it'll have to do for the moment...
 	// TODO check for full board! or game over detection
 	for {
-		x, y = randGen.Intn(b.width), randGen.Intn(b.height)
-		if b.tileAt(x, y) == nil {
+		x, y = b.rand.Intn(b.width), b.rand.Intn(b.height)
+		if b.free(x, y) {
 			break
 		}
 	}
 	b.addTileAt(x, y, v)
+	return b.tileAt(x, y)
 }
 
 // addTileAt adds a tile with the specified value at the specified position
 func (b *Board) addTileAt(x, y, v int) bool {
-	t := ctrl.createTile(v, x, y)
-	return b.insertTile(t)
+	return b.addKindAt(x, y, v, tileNumber)
 }
 
-// createMergeTest creates a board with several pairs of tiles that can be merged
-// (and one pair of "11" tiles that cannot be merged)
-func (b *Board) createMergeTest() {
-	b.clear()
-
-	b.addTileAt(0, 0, 4)
-	b.addTileAt(1, 0, 4)
-	b.addTileAt(2, 0, 5)
-	b.addTileAt(3, 0, 5)
-
-	b.addTileAt(0, 1, 6)
-	b.addTileAt(1, 1, 6)
-	b.addTileAt(2, 1, 7)
-	b.addTileAt(3, 1, 7)
-
-	b.addTileAt(0, 2, 8)
-	b.addTileAt(1, 2, 8)
-	b.addTileAt(2, 2, 9)
-	b.addTileAt(3, 2, 9)
-
-	b.addTileAt(0, 3, 10)
-	b.addTileAt(1, 3, 10)
-	b.addTileAt(2, 3, 11)
-	b.addTileAt(3, 3, 11)
-}
-
-// createGameOverTest creates a board which is guaranteed to lead to
-// "Game Over" after the next move
-func (b *Board) createGameOverTest() {
-	b.clear()
-
-	b.addTileAt(0, 0, 3)
-	b.addTileAt(1, 0, 4)
-	b.addTileAt(2, 0, 3)
-	b.addTileAt(3, 0, 4)
-
-	b.addTileAt(0, 1, 5)
-	b.addTileAt(1, 1, 6)
-	b.addTileAt(2, 1, 5)
-	b.addTileAt(3, 1, 6)
-
-	b.addTileAt(0, 2, 7)
-	b.addTileAt(1, 2, 8)
-	b.addTileAt(2, 2, 7)
-	b.addTileAt(3, 2, 8)
-
-	b.addTileAt(0, 3, 9)
-	b.addTileAt(1, 3, 11)
-	b.addTileAt(2, 3, 9)
+// newTile creates a tile of the given value at the given position. Simulated boards get
+// tiles without a QML object.
+func (b *Board) newTile(value, x, y int) *Tile {
+	if b.ctrl != nil {
+		t := b.ctrl.createTile(value, x, y)
+		b.ctrl.animateTile(t, currentTheme.Animations.Spawn, 0)
+		return t
+	}
+	t := &Tile{}
+	t.SetPos(x, y)
+	t.SetValue(value)
+	return t
 }
 
 // gameOverCheck returns "done" if
 // - the board is full and no more moves are possible
-// - a 2048 tile is present
+// - a 2048 tile (or the goal of the merge rule) is present
 // in case of a 2048 tile, "won" is true as well
 func (b *Board) gameOverCheck() (done bool, won bool) {
 	done = false
 	won = false
+	goal := b.mergeRule().goal()
 
 	// return false if free space
 	boardFull := true
@@ -185,7 +182,7 @@ func (b *Board) gameOverCheck() (done bool, won bool) {
 		if tile == nil {
 			boardFull = false
 		} else {
-			if tile.Value() == maxTileValue {
+			if tile.Value() == goal {
 				won = true
 				return
 			}
@@ -196,17 +193,14 @@ func (b *Board) gameOverCheck() (done bool, won bool) {
 	}
 
 	// try all possible moves of all possible tiles
+	topo := b.topology()
 	for _, tile := range b.tiles {
-		for dx := -1; dx <= 1; dx++ {
-			for dy := -1; dy <= 1; dy++ {
-				if dx != 0 && dy != 0 || dx == 0 && dy == 0 {
-					continue
-				}
-				newx, newy, _ := b.getMoveTarget(tile, dx, dy)
-				if newx != tile.x || newy != tile.y {
-					//fmt.Println("tile @", tile.x, tile.y, "can move to", newx, newy)
-					return
-				}
+		for i := 0; i < len(topo.directions()); i++ {
+			dx, dy, _ := topo.step(topo.directions()[i])
+			newx, newy, _ := b.getMoveTarget(tile, dx, dy)
+			if newx != tile.x || newy != tile.y {
+				//fmt.Println("tile @", tile.x, tile.y, "can move to", newx, newy)
+				return
 			}
 		}
 	}
@@ -218,24 +212,31 @@ func (b *Board) gameOverCheck() (done bool, won bool) {
 
 // getMoveTarget gets the new position for the given tile in the direction given by dx and dy.
 // If a tile that can merge with the current tile is in the way, the position of that tile is returned and otherTile
-// is set to that tile.
+// is set to that tile. Tiles move as far as they can, or as far as the merge rule lets them slide.
 func (b *Board) getMoveTarget(tile *Tile, dx, dy int) (x, y int, otherTile *Tile) {
 	x, y = tile.x, tile.y
+	if tile.immovable() {
+		return
+	}
+	rule := b.mergeRule()
+	topo := b.topology()
 	curx, cury := x, y
-	for {
+	for steps := 0; rule.slide() == 0 || steps < rule.slide(); steps++ {
 		curx, cury = curx+dx, cury+dy
-		if curx < 0 || curx > boardSize-1 || cury < 0 || cury > boardSize-1 {
+		if !topo.contains(curx, cury) {
 			break
 		}
 		candidate := b.tileAt(curx, cury)
-		if candidate == nil || candidate.Value() == tile.Value() && tile.Value() < maxTileValue && candidate.NextValue == 0 {
+		if candidate == nil {
 			//fmt.Println("setting x, y", curx, cury)
 			x, y = curx, cury
-			otherTile = candidate
+			continue
 		}
-		if candidate != nil {
-			return
+		if _, ok := tile.mergesWith(candidate, rule); ok {
+			x, y = curx, cury
+			otherTile = candidate
 		}
+		return
 	}
 	return
 }
@@ -246,27 +247,65 @@ func (b *Board) clear() {
 		if t != nil {
 			// remove tiles
 			b.removeTile(t)
-			t.Object.Destroy()
+			t.destroy()
 		}
 	}
 }
 
-// newGame clears the board and adds two random tiles
-func (b *Board) newGame() {
+// newGame clears the board and adds two random tiles. The random tiles of the game are
+// determined by seed.
+func (b *Board) newGame(seed int64) {
+	b.reset(seed)
+	b.addRandomTile()
+	b.addRandomTile()
+}
+
+// reset clears the board for a new game
+func (b *Board) reset(seed int64) {
 	b.clear()
+	if n := len(cells(b.topology())); len(b.tiles) != n {
+		b.tiles = make([]*Tile, n)
+	}
+	if b.ctrl != nil && b.ctrl.layout.topo != b.topology() {
+		b.ctrl.relayout()
+	}
+	b.score = 0
+	b.seed = seed
+	b.rand = rand.New(rand.NewSource(seed))
+	b.moves = nil
+	b.start = ""
+	b.puzzle = false
+	b.spawns = nil
+	b.nextSpawn = 0
+	b.shared = false
+	b.specials = false
+}
+
+// classic returns whether the game is one of the original game: played by the classic merge
+// rule on the square grid, without special tiles, starting from an empty board
+func (b *Board) classic() bool {
+	return b.rule == "" && !b.hex && !b.specials && !b.puzzle && b.start == ""
+}
 
-	board.addRandomTile(2)
-	board.addRandomTile(2)
+// move executes the move in the given direction (see topology) and records it
+func (b *Board) move(dir byte) {
+	dx, dy, ok := b.topology().step(dir)
+	if !ok {
+		return
+	}
+	b.doMove(dx, dy)
+	if b.moved {
+		b.moves = append(b.moves, dir)
+	}
 }
 
-// doMove executes a move given by dx and dy. enumStrategy specifies an enumeration strategy function
-// which returns the positions on the board in the order in which they should move (i.e., when moving down,
-// the bottom row is checked first, then the one above etc.)
-func (b *Board) doMove(dx, dy int, next enumStrategy) {
-	// get starting point
-	x, y, done := next(-1, -1)
+// doMove executes a move given by dx and dy. The cells are visited in the order in which they
+// should move (see moveOrder; i.e., when moving down, the bottom row is checked first, then the
+// one above etc.)
+func (b *Board) doMove(dx, dy int) {
 	b.moved = false
-	for !done {
+	for _, c := range moveOrder(b.topology(), dx, dy) {
+		x, y := c[0], c[1]
 		t := b.tileAt(x, y)
 		if t != nil {
 			newx, newy, otherTile := b.getMoveTarget(t, dx, dy)
@@ -277,12 +316,14 @@ func (b *Board) doMove(dx, dy int, next enumStrategy) {
 			}
 			if otherTile != nil {
 				// mark tiles for merging
-				t.NextValue = t.Value() + 1
+				t.NextValue, _ = t.mergesWith(otherTile, b.mergeRule())
+				t.partner = otherTile
 				otherTile.NextValue = -1
-				ctrl.enableMerge = true
+				if b.ctrl != nil {
+					b.ctrl.enableMerge = true
+				}
 			}
 		}
-		x, y, done = next(x, y)
 	}
 }
 
@@ -290,28 +331,54 @@ func (b *Board) doMove(dx, dy int, next enumStrategy) {
 // This is done by setting the new (higher) value for one tile in each pair and removing the other one.
 // doMerge also handles calculating and updating the score.
 func (b *Board) doMerge() {
+	b.merges = b.merges[:0]
+	var bombs []*Tile
 	for _, t := range b.tiles {
 		if t != nil && t.NextValue != 0 {
 			if t.NextValue > 0 {
 				// marked for promotion
+				b.merges = append(b.merges, t.NextValue)
+				old := t.Value()
+				if t.kind == tileWild {
+					// a wildcard shows the value it merged with
+					old = t.partner.Value()
+				}
+				b.score += t.mergePoints(t.partner, t.NextValue, b.mergeRule())
+				if t.kind == tileBomb || t.partner.kind == tileBomb {
+					bombs = append(bombs, t)
+				}
+				t.kind = tileNumber
+				t.partner = nil
 				t.SetValue(t.NextValue)
-				t.Call("update")
-				ctrl.SetScore(ctrl.score + 1<<uint(t.NextValue))
+				if b.ctrl != nil {
+					b.ctrl.animateTile(t, currentTheme.Animations.Merge, old)
+					b.ctrl.updateBoard()
+					b.ctrl.showScore()
+				}
 				t.NextValue = 0
 			} else if t.NextValue == -1 {
 				// marked for deletion
 				// go out in a blaze of glory
-				ctrl.Emit(gridSize*t.x+gridSize/2, gridSize*t.y+2*gridSize/2, t.Value())
+				if b.ctrl != nil {
+					x, y := b.ctrl.fieldCenter(t.x, t.y)
+					b.ctrl.Emit(x, y, t.Value())
+				}
 				b.removeTile(t)
-				t.Object.Destroy()
+				t.destroy()
 			}
 		}
 	}
+	for _, t := range bombs {
+		b.explode(t.x, t.y)
+	}
+	if len(bombs) > 0 && b.ctrl != nil {
+		b.ctrl.updateBoard()
+	}
 }
 
 // setBounceAnim initiates the "bounce" animation sequence
 func (b *Board) setBounceAnim() {
-	for _, t := range board.tiles {
+	for _, t := range b.tiles {
 		if t != nil {
 			t.SetBounce(true)
 		}
@@ -322,30 +389,118 @@ func (b *Board) setBounceAnim() {
 
 // Control handles the interface with QML
 type Control struct {
+	Window      *qml.Window
 	Root        qml.Object
 	Score       qml.Object
 	Message     qml.Object
 	SubMessage  qml.Object
-	score       int
+	ThemeButton qml.Object
+	BoardView   qml.Object
+
+	BindingsScreen qml.Object
+	EditorPanel    qml.Object
+	LevelScreen    qml.Object
+	VersusScreen   qml.Object
+
+	puzzlePacks []*PuzzlePack // loaded when the level select screen is first opened
+	level       *puzzleEntry  // puzzle level being played
+	levelOver   bool          // the level has been solved or failed, no more moves
+	daily       string        // date of the daily challenge being played ("" if none)
+	versus      *versusGame   // versus game being played (nil if none)
+	online      *netConn      // connection to the match server in online games (nil if none)
+	rule        string        // merge rule of normal games (see mergeRules)
+
+	bindings *bindingTable
+	capture  string // action which gets the next key pressed on the bindings screen
+
+	AnimationTimer qml.Object
+	animations     []*rotationAnim
+
+	emitters       int                   // number of running particle emitters
+	particleGroups map[string]qml.Object // particle painters per spark color
+
+	// moves and undos waiting for the tiles to settle (see queueAction), the number of move
+	// animations still running, and whether tiles are currently placed without animation
+	queue        []string
+	pendingMoves int
+	instant      bool
+
 	hiscore     int
 	enableMerge bool
 	fallIndex   int
-	mouseDownX  int
-	mouseDownY  int
+
+	// paths of the pressed pointers by touch point id, and the direction they have been swiped
+	// in so far (0: none, -1: different directions)
+	swipes   map[int]*swipe
+	swipeDir int
+
+	// geometry of the board on screen, and the window geometry to return to from fullscreen
+	layout     layout
+	fullscreen bool
+	windowed   *WindowGeometry
 
 	Running  bool
+	paused   bool
+	editing  bool // the board editor is active
+	brush    int  // value of the tiles placed by the editor (0: remove tiles)
 	settings *GlobalSettings
+
+	// settings used while playing, cached by loadSettings so the settings file isn't read
+	// for every frame or event
+	camera           Camera
+	renderer         string
+	reducedMotion    bool
+	effects          float64 // factor of the particle effects, see effectsIntensity
+	queueDepth       int     // maximum number of buffered actions
+	skipAnimations   int     // number of buffered actions from which moves aren't animated (0: never)
+	swipeSensitivity float64 // factor for the swipe thresholds, see swipeRecognizer
 }
 
-// showScore displays the score
-func (ctrl *Control) showScore() {
-	ctrl.Score.Set("text", "Score: "+strconv.Itoa(ctrl.score)+" Hi: "+strconv.Itoa(ctrl.hiscore))
+// loadSettings reads the cached settings. It is called on startup and when a new game is
+// started, so changes made to the settings file while playing apply to the next game.
+func (ctrl *Control) loadSettings() {
+	ctrl.camera = defaultCamera
+	ctrl.renderer = ""
+	ctrl.reducedMotion = false
+	ctrl.effects = 1
+	ctrl.queueDepth = defaultQueueDepth
+	ctrl.skipAnimations = 0
+	ctrl.swipeSensitivity = 1
+	if ctrl.settings == nil {
+		return
+	}
+	ctrl.camera = ctrl.settings.GetCamera()
+	ctrl.renderer = ctrl.settings.GetRenderer()
+	ctrl.reducedMotion = ctrl.settings.GetReducedMotion()
+	ctrl.effects = effectsIntensity[ctrl.settings.GetEffects()]
+	if d := ctrl.settings.GetQueueDepth(); d > 0 {
+		ctrl.queueDepth = d
+	}
+	ctrl.skipAnimations = ctrl.settings.GetSkipAnimations()
+	if s := ctrl.settings.GetSwipeSensitivity(); s > 0 {
+		ctrl.swipeSensitivity = s
+	}
 }
 
-// SetScore sets the score and displays it
-func (ctrl *Control) SetScore(v int) {
-	ctrl.score = v
-	ctrl.showScore()
+// showScore displays the score
+func (ctrl *Control) showScore() {
+	if board.puzzle && ctrl.level != nil {
+		moves := strconv.Itoa(len(board.moves))
+		if goal := ctrl.level.pack.Levels[ctrl.level.level].Goal; goal.Moves != 0 {
+			moves += "/" + strconv.Itoa(goal.Moves)
+		}
+		ctrl.Score.Set("text", "Moves: "+moves+" Score: "+strconv.Itoa(board.score))
+		return
+	}
+	if ctrl.daily != "" {
+		ctrl.Score.Set("text", "Daily: "+strconv.Itoa(board.score))
+		return
+	}
+	if board.rule != "" {
+		ctrl.Score.Set("text", ruleLabel(board.rule)+": "+strconv.Itoa(board.score))
+		return
+	}
+	ctrl.Score.Set("text", "Score: "+strconv.Itoa(board.score)+" Hi: "+strconv.Itoa(ctrl.hiscore))
 }
 
 // SetScore sets the highscore, displays it and saves it
@@ -371,100 +526,51 @@ func (ctrl *Control) SetMessage(m1, m2 string) {
 	ctrl.SubMessage.Set("text", m2)
 }
 
-// Emit shows a particle ("spark") animation at position x, y
-// higher level values increase the intensity of the effect
-func (ctrl *Control) Emit(x, y, level int) {
-	component := ctrl.Root.Object("emitterComponent")
-	for i := 0; i <= level*2; i++ {
-		emitter := component.Create(nil)
-		emitter.Set("x", x)
-		emitter.Set("y", y)
-		emitter.Set("targetX", rand.Intn(240)-120+x)
-		emitter.Set("targetY", rand.Intn(240)-120+y)
-		emitter.Set("life", rand.Intn(200*level)+400)
-		emitter.Set("emitRate", rand.Intn(5*level)+20)
-		emitter.ObjectByName("xAnim").Call("start")
-		emitter.ObjectByName("yAnim").Call("start")
-		emitter.Set("enabled", true)
-	}
-}
-
-// Done handles the timeout event which ends the particle animation
-func (ctrl *Control) Done(emitter qml.Object) {
-	emitter.Destroy()
-}
-
-// HandleKey handles keyboard events
-func (ctrl *Control) HandleKey(key int) {
-	if !ctrl.Running {
-		ctrl.SetRunning(true)
-	}
-	switch key {
-	case 16777234:
-		board.doMove(-1, 0, enumFromLeft)
-	case 16777235:
-		board.doMove(0, -1, enumFromTop)
-	case 16777236:
-		board.doMove(1, 0, enumFromRight)
-	case 16777237:
-		board.doMove(0, 1, enumFromBottom)
-		/*default:
-		fmt.Println(key)*/
-	}
-}
-
-func (ctrl *Control) HandleMouseDown(xPos, yPos int) {
-	if !ctrl.Running {
-		ctrl.SetRunning(true)
-	}
-	ctrl.mouseDownX, ctrl.mouseDownY = xPos, yPos
-}
-
-func intAbs(x int) int {
-	if x < 0 {
-		return -x
-	}
-	return x
-}
-
-func (ctrl *Control) HandleMouseUp(xPos, yPos int) {
-	dx := ctrl.mouseDownX - xPos
-	dy := ctrl.mouseDownY - yPos
-
-	if intAbs(dx) > 30 && intAbs(dy) < intAbs(dx)/2 {
-		// horizontal swipe
-		if dx > 0 {
-			board.doMove(-1, 0, enumFromLeft)
-		} else {
-			board.doMove(1, 0, enumFromRight)
-		}
-	}
-	if intAbs(dy) > 30 && intAbs(dx) < intAbs(dy)/2 {
-		// vertical swipe
-		if dy > 0 {
-			board.doMove(0, -1, enumFromTop)
-		} else {
-			board.doMove(0, 1, enumFromBottom)
-		}
-	}
-}
-
 // HandleMoveAnimationDone is called at the end of the move animation which runs automatically when
 // the position of a tile is changed. It initiates the merging of the tiles which now overlap.
 // It then proceeds to the next move by adding a random tile to the board, checking for game over
 // and displaying appropriate messages in this case.
 func (ctrl *Control) HandleMoveAnimationDone() {
+	// wait for the last tile to arrive
+	if ctrl.pendingMoves > 0 {
+		ctrl.pendingMoves--
+		if ctrl.pendingMoves > 0 {
+			return
+		}
+	}
 	if ctrl.enableMerge {
 		board.doMerge()
 		ctrl.enableMerge = false
 	}
 	if board.moved {
-		board.addRandomTile(2)
+		board.spawnTile()
+		if board.puzzle && ctrl.level != nil {
+			ctrl.showScore()
+			ctrl.levelOver = ctrl.checkPuzzle()
+			board.moved = false
+			ctrl.nextAction()
+			return
+		}
 		done, won := board.gameOverCheck()
+		if ctrl.daily != "" && (done || won) {
+			// the daily challenge ends here, its score is kept apart from the high score
+			ctrl.saveLastGame()
+			ctrl.clearQueue()
+			ctrl.showDailyResult()
+			board.setBounceAnim()
+			board.moved = false
+			return
+		}
+		if done || won {
+			ctrl.saveLastGame()
+			ctrl.clearQueue()
+		}
+		// the high score is the one of the classic game
+		hiscore := board.classic() && board.score >= ctrl.hiscore
 		if done {
-			if ctrl.score >= ctrl.hiscore {
+			if hiscore {
 				ctrl.SetMessage("New High Score!", "click 'Restart'")
-				ctrl.SetHiScore(ctrl.score)
+				ctrl.SetHiScore(board.score)
 				board.setBounceAnim()
 			} else {
 				ctrl.SetMessage("Game Over!", "click 'Restart'")
@@ -474,12 +580,18 @@ func (ctrl *Control) HandleMoveAnimationDone() {
 		}
 		if won {
 			ctrl.SetMessage("Congratulations, you have done it!", "click 'Restart'")
-			if ctrl.score >= ctrl.hiscore {
-				ctrl.SetHiScore(ctrl.score)
+			for _, t := range board.tiles {
+				if t != nil && t.Value() == board.mergeRule().goal() {
+					ctrl.animateTile(t, currentTheme.Animations.Win, 0)
+				}
+			}
+			if hiscore {
+				ctrl.SetHiScore(board.score)
 			}
 			board.setBounceAnim()
 		}
 		board.moved = false
+		ctrl.nextAction()
 	}
 }
 
@@ -487,18 +599,113 @@ func (ctrl *Control) HandleMoveAnimationDone() {
 // the next one fall.
 func (ctrl *Control) HandleFallAnimationDone() {
 	ctrl.fallIndex++
-	if ctrl.fallIndex < boardSize*boardSize {
+	if ctrl.fallIndex < len(board.tiles) {
 		board.tiles[ctrl.fallIndex].SetFall(true)
 	}
 }
 
 // HandleRestartButton handles a click of the restart button
 func (ctrl *Control) HandleRestartButton() {
-	board.newGame()
-	ctrl.SetScore(0)
+	ctrl.loadSettings()
+	if ctrl.online != nil {
+		ctrl.startOnline()
+		return
+	}
+	if ctrl.versus != nil {
+		ctrl.startVersus(ctrl.versus.attack)
+		return
+	}
+	ctrl.saveLastGame()
+	ctrl.paused = false
+	ctrl.clearQueue()
+	if board.puzzle && ctrl.level != nil {
+		ctrl.startLevel(ctrl.level)
+		return
+	}
+	// games started from a layout restart from it, games with special tiles keep them
+	specials := board.specials
+	if err := board.newGameFrom(time.Now().UnixNano(), board.start); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot restart: %v\n", err)
+	}
+	board.specials = specials
+	ctrl.showScore()
 	ctrl.SetMessage("", "")
 }
 
+// saveLastGame writes the recording of the current game to the last game file,
+// so it can be replayed with "gofusion animate". It is called whenever a game ends,
+// which also ends a daily challenge.
+func (ctrl *Control) saveLastGame() {
+	if ctrl.daily != "" {
+		ctrl.finishDaily()
+	}
+	if len(board.moves) == 0 {
+		return
+	}
+	fileName := lastGameFile()
+	if fileName == "" {
+		return
+	}
+	r := board.recording()
+	if err := r.write(fileName); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot save game: %v\n", err)
+	}
+}
+
+// HandleExportButton handles a click of the export button by writing the board
+// as 3D mesh (STL) to the user's home directory
+func (ctrl *Control) HandleExportButton() {
+	dir := "."
+	if u, err := user.Current(); err == nil {
+		dir = u.HomeDir
+	}
+	fileName := filepath.Join(dir, "gofusion-board-"+time.Now().Format("20060102-150405")+".stl")
+	if err := board.exportBoard(fileName, currentTheme); err != nil {
+		ctrl.SetMessage("Export failed", err.Error())
+		return
+	}
+	ctrl.SetMessage("Board exported", fileName)
+}
+
+// HandleThemeButton handles a click of the theme button by switching to the next theme
+func (ctrl *Control) HandleThemeButton() {
+	i := 0
+	for i < len(themes) && themes[i] != currentTheme {
+		i++
+	}
+	next := themes[(i+1)%len(themes)]
+	if err := next.loadModels(assets); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot load theme %q: %v\n", next.Name, err)
+		return
+	}
+	currentTheme = next
+	ctrl.applyTheme()
+	if ctrl.settings != nil {
+		ctrl.settings.SetTheme(currentTheme.Name)
+	}
+}
+
+// applyTheme passes the background, font and particle image of the current theme
+// to the QML side and repaints all tiles
+func (ctrl *Control) applyTheme() {
+	ctrl.Root.Set("backgroundTop", currentTheme.Background.Top)
+	ctrl.Root.Set("backgroundBottom", currentTheme.Background.Bottom)
+	ctrl.Root.Set("fontFamily", currentTheme.Font)
+	if src := currentTheme.ParticleSource(); src != "" {
+		ctrl.Root.Set("particleSource", src)
+	} else {
+		ctrl.Root.Set("particleSource", "particle.png")
+	}
+	ctrl.ThemeButton.Set("text", "Theme: "+currentTheme.Name)
+	ctrl.applyParticles()
+	ctrl.updateBoard()
+}
+
+// updateBoard makes the board view repaint the board
+func (ctrl *Control) updateBoard() {
+	ctrl.BoardView.Call("update")
+}
+
 // createTile creates a new tile object of the given value at the given position
 func (ctrl *Control) createTile(value, x, y int) (t *Tile) {
 	t = &Tile{}
@@ -509,10 +716,14 @@ func (ctrl *Control) createTile(value, x, y int) (t *Tile) {
 	parent := ctrl.Root.ObjectByName("gameCanvas")
 	//fmt.Println(parent)
 	tile.Set("parent", parent)
-	tile.Set("width", tileSize)
-	tile.Set("height", tileSize)
+	tile.Set("width", ctrl.layout.tile)
+	tile.Set("height", ctrl.layout.tile)
 	t.Object = tile
+	// new tiles appear in place
+	instant := ctrl.instant
+	ctrl.instant = true
 	t.SetPos(x, y)
+	ctrl.instant = instant
 	t.SetValue(value)
 
 	return
@@ -520,38 +731,69 @@ func (ctrl *Control) createTile(value, x, y int) (t *Tile) {
 
 // ### TILE ###
 
-// Tile represents one tile on the board, with an embedded qml.Object
+// Tile represents one tile on the board, with an embedded qml.Object.
+// The QML object holds the (animated) position and size of the tile; the tile
+// itself is painted by BoardView.
 type Tile struct {
 	qml.Object
 
-	models [12]map[string]*Object
-
-	//Value    int
 	Rotation  int
 	NextValue int
 
-	x int
-	y int
+	x       int
+	y       int
+	value   int
+	kind    tileKind
+	partner *Tile // the tile this one merges with (see doMove)
+	shown   int   // value shown instead of value during an animation (0: none)
 }
 
-// SetPos sets the position of the tile, automatically starting a QML animation
+// SetPos sets the position of the tile, automatically starting a QML animation unless the
+// controller places tiles instantly
 func (t *Tile) SetPos(x, y int) {
-	t.Set("x", gridSize*x)
-	t.Set("y", gridSize*y+gridSize/2)
-	t.Set("z", y) // for animations, lower lines on screen are in front of higher lines
+	if t.Object != nil {
+		px, py := ctrl.layout.pos(x, y)
+		if ctrl.instant {
+			t.Set("animate", false)
+		} else {
+			// count the animations started, see HandleMoveAnimationDone
+			if t.Float64("x") != float64(px) {
+				ctrl.pendingMoves++
+			}
+			if t.Float64("y") != float64(py) {
+				ctrl.pendingMoves++
+			}
+		}
+		t.Set("x", px)
+		t.Set("y", py)
+		t.Set("z", y) // for animations, lower lines on screen are in front of higher lines
+		t.Set("animate", true)
+	}
 	t.x = x
 	t.y = y
 }
 
+// destroy removes the QML object of the tile (if any)
+func (t *Tile) destroy() {
+	if t.Object != nil {
+		t.Object.Destroy()
+	}
+}
+
 // SetBounce enables the "bounce" animation for this tile
 func (t *Tile) SetBounce(enabled bool) {
-	y0 := gridSize * t.y
-	y1 := y0 - (12-t.Value())*8
+	// higher tiles bounce less (the goals of some merge rules are above 2048)
+	v := t.Value()
+	if v > maxTileValue {
+		v = maxTileValue
+	}
+	_, y0 := ctrl.layout.pos(t.x, t.y)
+	y1 := y0 - int(float64((12-v)*8)*ctrl.layout.scale())
 	//fmt.Println(t.Value(), y0, y1)
 	if enabled {
 		t.Set("bounceY0", y0)
 		t.Set("bounceY1", y1)
-		t.Set("bounceDuration", (12-t.Value())*30)
+		t.Set("bounceDuration", (12-v)*30)
 		t.Set("pauseDuration", randGen.Intn(2000)+1)
 		t.Set("bounceEnable", true)
 	} else {
@@ -568,166 +810,34 @@ func (t *Tile) SetFall(enabled bool) {
 	}
 }
 
-// SetValue sets the value of the tile (only stored on the QML side).
+// SetValue sets the value of the tile (and passes it on to the QML side).
 // The value displayed on the tile is 2^nvalue.
 func (t *Tile) SetValue(v int) {
-	t.Set("nvalue", v)
+	t.value = v
+	if t.Object != nil {
+		t.Set("nvalue", v)
+	}
 }
 
-// Value gets the value of the tile (only stored on the QML side).
+// Value gets the value of the tile.
 // The value displayed on the tile is 2^nvalue.
 func (t *Tile) Value() int {
-	return t.Int("nvalue")
+	return t.value
+}
+
+// displayValue returns the value displayed on the tile, which lags behind the real one while
+// a flip animation reveals it
+func (t *Tile) displayValue() int {
+	if t.shown != 0 {
+		return t.shown
+	}
+	return t.value
 }
 
 // SetRotation sets the rotation angle of the tile and updates its image
 func (t *Tile) SetRotation(rotation int) {
 	t.Rotation = rotation
-	t.Call("update")
-}
-
-// Paint repaints the tile using OpenGL functions.
-// Tiles currently have orthogonal projection, and each tile is rendered "on its own"
-// (i.e., it has its own OpenGL scene graph).
-func (t *Tile) Paint(p *qml.Painter) {
-	width := float32(t.Int("width"))
-
-	// TODO: find out how to use perspective projection ?!
-	/*gl.MatrixMode(gl.PROJECTION)
-	gl.LoadIdentity()
-	//gl.Frustum(-100.0, 100.0, -100.0, 100.0, 3.0, 10.0)
-	gl.Frustum(-1.0, 1.0, -1.0, 1.0, 3.0, 10.0)
-	gl.MatrixMode(gl.MODELVIEW)*/
-	gl := GL.API(p)
-
-	gl.Enable(GL.BLEND)
-	gl.BlendFunc(GL.SRC_ALPHA, GL.ONE_MINUS_SRC_ALPHA)
-
-	gl.ShadeModel(GL.SMOOTH)
-	gl.Enable(GL.DEPTH_TEST)
-	gl.DepthMask(true)
-	gl.Enable(GL.NORMALIZE)
-
-	gl.Clear(GL.DEPTH_BUFFER_BIT)
-
-	gl.Scalef(width/3, width/3, width/3)
-
-	lks := []float32{0.3, 0.3, 0.3, 1.0}
-	switch t.Value() {
-	/*case 1: // 2
-		lks = []gl.Float{0.3, 0.3, 0.1, 1.0}
-	case 2: // 4
-		lks = []gl.Float{0.1, 0.3, 0.1, 1.0}
-	case 3: // 8
-		lks = []gl.Float{0.1, 0.3, 0.3, 1.0}
-	case 4: // 16
-		lks = []gl.Float{0.1, 0.1, 0.3, 1.0}
-	case 5: // 32
-		lks = []gl.Float{0.3, 0.1, 0.3, 1.0}
-	case 6: // 64
-		lks = []gl.Float{0.3, 0.1, 0.1, 1.0}
-	case 7: // 128
-		lks = []gl.Float{0.1, 0.3, 0.1, 1.0}
-	case 8: // 256
-		lks = []gl.Float{0.1, 0.3, 0.1, 1.0}
-	case 9: // 512
-		lks = []gl.Float{0.1, 0.3, 0.1, 1.0}
-	case 10: // 1024
-		lks = []gl.Float{0.1, 0.3, 0.1, 1.0}
-	case 11: // 2048
-		lks = []gl.Float{0.1, 0.3, 0.1, 1.0}*/
-	/*case 1: // 2
-		lks = []gl.Float{0.1, 0.1, 0.6, 1.0}
-	case 2: // 4
-		lks = []gl.Float{0.2, 0.1, 0.4, 1.0}
-	case 3: // 8
-		lks = []gl.Float{0.4, 0.1, 0.2, 1.0}
-	case 4: // 16
-		lks = []gl.Float{0.6, 0.1, 0.1, 1.0}
-	case 5: // 32
-		lks = []gl.Float{0.4, 0.2, 0.1, 1.0}
-	case 6: // 64
-		lks = []gl.Float{0.2, 0.4, 0.1, 1.0}
-	case 7: // 128
-		lks = []gl.Float{0.1, 0.6, 0.1, 1.0}
-	case 8: // 256
-		lks = []gl.Float{0.1, 0.3, 0.1, 1.0}
-	case 9: // 512
-		lks = []gl.Float{0.1, 0.3, 0.1, 1.0}
-	case 10: // 1024
-		lks = []gl.Float{0.1, 0.3, 0.1, 1.0}
-	case 11: // 2048
-		lks = []gl.Float{0.1, 0.3, 0.1, 1.0}
-	}*/
-
-	case 1: // 2
-		lks = []float32{0.1, 0.1, 0.5, 1.0}
-	case 2: // 4
-		lks = []float32{0.1, 0.2, 0.3, 1.0}
-	case 3: // 8
-		lks = []float32{0.1, 0.3, 0.2, 1.0}
-	case 4: // 16
-		lks = []float32{0.1, 0.5, 0.1, 1.0}
-	case 5: // 32
-		lks = []float32{0.2, 0.3, 0.1, 1.0}
-	case 6: // 64
-		lks = []float32{0.3, 0.2, 0.1, 1.0}
-	case 7: // 128
-		lks = []float32{0.5, 0.1, 0.1, 1.0}
-	case 8: // 256
-		lks = []float32{0.3, 0.1, 0.2, 1.0}
-	case 9: // 512
-		lks = []float32{0.2, 0.1, 0.3, 1.0}
-	case 10: // 1024
-		lks = []float32{0.1, 0.1, 0.7, 1.0}
-	case 11: // 2048
-		lks = []float32{0.7, 0.3, 0.3, 1.0}
-	}
-
-	//lka := []gl.Float{0.3, 0.3, 0.3, 1.0}
-	//lkd := []gl.Float{0.3, 0.3, 0.3, 0.0}
-
-	lpos := []float32{-2, 3, 3, 1.0}
-	//lpos := []gl.Float{-100, 100, 100, 1.0}
-
-	gl.Enable(GL.LIGHTING)
-	//gl.Lightfv(gl.LIGHT0, gl.AMBIENT, lka)
-	//gl.Lightfv(gl.LIGHT0, gl.DIFFUSE, lkd)
-	gl.Lightfv(GL.LIGHT0, GL.SPECULAR, lks)
-	gl.Lightfv(GL.LIGHT0, GL.POSITION, lpos)
-	gl.Enable(GL.LIGHT0)
-
-	gl.EnableClientState(GL.NORMAL_ARRAY)
-	gl.EnableClientState(GL.VERTEX_ARRAY)
-
-	gl.Translatef(1.5, 1.5, 0)
-	if t.Value() != 11 {
-		gl.Rotatef(-90, 0, 0, 1)
-	} else {
-		gl.Translatef(0.48, -0.45, 0)
-	}
-	gl.Rotatef(float32(90+((36000+t.Rotation)%360)), 1, 0, 0)
-
-	gl.Disable(GL.COLOR_MATERIAL)
-
-	model := t.models[t.Value()]
-	//fmt.Println("painting", &t, t.Value())
-	for _, obj := range model {
-		for _, group := range obj.Groups {
-			gl.Materialfv(GL.FRONT, GL.AMBIENT, group.Material.Ambient)
-			gl.Materialfv(GL.FRONT, GL.DIFFUSE, group.Material.Diffuse)
-			gl.Materialfv(GL.FRONT, GL.SPECULAR, group.Material.Specular)
-			gl.Materialf(GL.FRONT, GL.SHININESS, group.Material.Shininess)
-			gl.VertexPointer(3, GL.FLOAT, 0, group.Vertexes)
-			gl.NormalPointer(GL.FLOAT, 0, group.Normals)
-			gl.DrawArrays(GL.TRIANGLES, 0, len(group.Vertexes)/3)
-		}
-	}
-
-	gl.Enable(GL.COLOR_MATERIAL)
-
-	//gl.DisableClientState(gl.NORMAL_ARRAY)
-	//gl.DisableClientState(gl.VERTEX_ARRAY)
+	ctrl.updateBoard()
 }
 
 // ### INIT / RUN ###
@@ -736,21 +846,30 @@ func run() error {
 	//qml.Init(nil)
 	engine := qml.NewEngine()
 
-	initTiles()
+	if err := initTiles(); err != nil {
+		return fmt.Errorf("cannot load tiles: %v", err)
+	}
 
-	component, err := engine.LoadFile(filename)
+	qmlFile := filename
+	if qmlFile == "" {
+		var err error
+		qmlFile, err = assets.Path("gofusion.qml")
+		if err != nil {
+			return err
+		}
+	}
+	component, err := engine.LoadFile(qmlFile)
 	if err != nil {
 		return err
 	}
 
 	// init window
 	win := component.CreateWindow(nil)
-	win.Set("x", 600)
-	win.Set("y", 675)
 
 	// init control object (used for communicating with the QML code)
 	// and pass it to the QML code.
 	ctrl = Control{}
+	ctrl.Window = win
 	ctrl.Root = win.Root()
 	context := engine.Context()
 	context.SetVar("ctrl", &ctrl)
@@ -758,53 +877,73 @@ func run() error {
 	ctrl.Score = ctrl.Root.ObjectByName("score")
 	ctrl.Message = ctrl.Root.ObjectByName("message")
 	ctrl.SubMessage = ctrl.Root.ObjectByName("submessage")
-
-	u, err := user.Current()
-	if err != nil {
-		fmt.Println(err.Error())
-	} else {
-		hiScoreFile := filepath.Join(u.HomeDir, ".gofusion")
-		ctrl.settings = NewGlobalSettings(hiScoreFile)
-		if ctrl.settings != nil {
-			ctrl.hiscore = int(ctrl.settings.GetHiScore())
+	ctrl.ThemeButton = ctrl.Root.ObjectByName("themeButton")
+	ctrl.BoardView = ctrl.Root.ObjectByName("boardView")
+	ctrl.AnimationTimer = ctrl.Root.ObjectByName("animationTimer")
+	ctrl.BindingsScreen = ctrl.Root.ObjectByName("bindingsScreen")
+	ctrl.EditorPanel = ctrl.Root.ObjectByName("editorPanel")
+	ctrl.LevelScreen = ctrl.Root.ObjectByName("levelScreen")
+	ctrl.VersusScreen = ctrl.Root.ObjectByName("versusScreen")
+	ctrl.applyTheme()
+
+	ctrl.settings = settings
+	ctrl.loadSettings()
+	name := ruleName
+	if ctrl.settings != nil {
+		ctrl.hiscore = int(ctrl.settings.GetHiScore())
+		if name == "" {
+			name = ctrl.settings.GetRule()
 		}
 	}
+	if _, ok := mergeRules[name]; !ok {
+		return fmt.Errorf("unknown merge rule %q (known rules: %s)", name, ruleNames())
+	}
+	ctrl.setRule(name)
+	defer ctrl.saveLastGame()
+	ctrl.initBindings()
 
-	board = Board{width: boardSize, height: boardSize}
+	board = Board{width: boardSize, height: boardSize, rule: ctrl.rule, ctrl: &ctrl}
+	ctrl.initWindow(fullscreen)
+	ctrl.relayout()
 
-	board.newGame()
-	/*board.createGameOverTest()
-	ctrl.fallIndex = 0
-	board.tiles[ctrl.fallIndex].SetFall(true)*/
+	start := ""
+	if scenario != "" {
+		if start, err = loadScenario(scenario); err != nil {
+			return err
+		}
+	}
+	if err := board.newGameFrom(time.Now().UnixNano(), start); err != nil {
+		return fmt.Errorf("%s: %v", scenario, err)
+	}
 
 	win.Show()
 	win.Wait()
+	ctrl.saveWindow()
 
 	return nil
 }
 
-// initTiles loads the 3D models for the tiles and registers the "Tile" type with QML
+// initTiles loads the themes and the 3D models for the tiles of the selected theme
+// and registers the "BoardView" type (which paints the tiles) with QML
 func initTiles() error {
 	var err error
-	var models [12]map[string]*Object
-
-	for i := range models {
-		if i == 0 {
-			continue
-		}
-
-		models[i], err = Read(fmt.Sprintf("model/tile_%04d.obj", 1<<uint(i)))
-		if err != nil {
-			return err
-		}
+	themes, err = loadThemes(assets)
+	if err != nil {
+		return err
+	}
+	name := ""
+	if settings != nil {
+		name = settings.GetTheme()
+	}
+	currentTheme = findTheme(themes, name)
+	if err = currentTheme.loadModels(assets); err != nil {
+		return err
 	}
-	//fmt.Println(models)
 
 	qml.RegisterTypes("GoExtensions", 1, 0, []qml.TypeSpec{
 		{
-			Init: func(g *Tile, obj qml.Object) {
-				g.Object = obj
-				g.models = models
+			Init: func(v *BoardView, obj qml.Object) {
+				v.Object = obj
 			},
 		},
 	})
@@ -812,75 +951,81 @@ func initTiles() error {
 	return nil
 }
 
-var filename = "gofusion.qml"
+// filename is the QML file to load; if empty, the one from the assets is used
+var filename string
 
-func main() {
+// fullscreen is set by the -fullscreen flag
+var fullscreen bool
 
-	if len(os.Args) == 2 {
-		filename = os.Args[1]
-	}
-	if err := qml.Run(run); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
-	}
-}
+// server is the address of the match server for online games, set by the -server flag
+var server string
 
-// ### ENUM STRATEGIES ###
+// ruleName is the merge rule of normal games, set by the -rule flag (default: from the settings)
+var ruleName string
 
-// enumFromLeft is an enumStrategy enumerating fields from left to right
-func enumFromLeft(cx, cy int) (x, y int, done bool) {
-	if cx == -1 {
-		return 0, 0, false
-	}
-	cy++
-	if cy >= boardSize {
-		cx++
-		cy = 0
+// scenario is the board layout to start with, set by the -scenario flag: the name of a built-in
+// scenario or a layout file
+var scenario string
+
+var assets *Assets
+var settings *GlobalSettings
+var themes []*Theme
+
+// loadSettings opens the settings file in the user's home directory
+func loadSettings() *GlobalSettings {
+	u, err := user.Current()
+	if err != nil {
+		fmt.Println(err.Error())
+		return nil
 	}
-	return cx, cy, (cx >= boardSize)
+	return NewGlobalSettings(filepath.Join(u.HomeDir, ".gofusion"))
 }
 
-// enumFromRight is an enumStrategy enumerating fields from right to left
-func enumFromRight(cx, cy int) (x, y int, done bool) {
-	if cx == -1 {
-		return boardSize - 1, 0, false
-	}
-	cy++
-	if cy >= boardSize {
-		cx--
-		cy = 0
+// lastGameFile returns the name of the file the last game is recorded in
+// (empty if the home directory is unknown)
+func lastGameFile() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
 	}
-	return cx, cy, (cx < 0)
+	return filepath.Join(u.HomeDir, ".gofusion-lastgame")
 }
 
-// enumFromTop is an enumStrategy enumerating fields from the top down
-func enumFromTop(cx, cy int) (x, y int, done bool) {
-	if cx == -1 {
-		return 0, 0, false
-	}
-	cx++
-	if cx >= boardSize {
-		cy++
-		cx = 0
+// openAssets creates the asset resolver. If overrideDir is empty,
+// the override directory from the settings is used.
+func openAssets(overrideDir string) *Assets {
+	if overrideDir == "" && settings != nil {
+		overrideDir = settings.GetAssetDir()
 	}
-	return cx, cy, (cy >= boardSize)
+	return NewAssets(overrideDir)
 }
 
-// enumFromBottom is an enumStrategy enumerating fields from the bottom up
-func enumFromBottom(cx, cy int) (x, y int, done bool) {
-	if cx == -1 {
-		return 0, boardSize - 1, false
+func main() {
+	settings = loadSettings()
+
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	assetDir := flag.String("assets", "", "directory with assets overriding the built-in ones")
+	flag.BoolVar(&fullscreen, "fullscreen", false, "start in fullscreen mode")
+	flag.StringVar(&server, "server", "", "address of the match server for online games (default: localhost:"+defaultServerPort+")")
+	flag.StringVar(&ruleName, "rule", "", "merge rule of normal games ("+ruleNames()+"; default: the one of 2048)")
+	flag.StringVar(&scenario, "scenario", "", "start from a built-in scenario ("+scenarioNames()+") or a board layout file")
+	flag.Parse()
+	assets = openAssets(*assetDir)
+
+	if flag.NArg() == 1 {
+		filename = flag.Arg(0)
 	}
-	cx++
-	if cx >= boardSize {
-		cy--
-		cx = 0
+	if err := qml.Run(run); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
 	}
-	return cx, cy, (cy < 0)
 }
-
-// enumStrategy is a function that specifies the order of enumeration of fields on the board.
-// When called with -1, -1, it should return the initial position of the enumeration.
-// When called with a position (x, y), it should return the next position.
-// "done" should be true when all positions have been enumerated.
-type enumStrategy func(cx, cy int) (x, y int, done bool)
@@ -1,5 +1,7 @@
 import QtQuick 2.0
+import QtQuick.Window 2.2
 import QtQuick.Particles 2.0
+import QtQuick.Dialogs 1.1
 import QtGraphicalEffects 1.0
 //import Qt3D 1.0
 import GoExtensions 1.0
@@ -10,120 +12,534 @@ Rectangle {
 	color: "navy"
 	focus: true
 
-    MouseArea {
-        anchors.fill: parent
+    // set from the selected theme
+    property color backgroundTop: "#001166"
+    property color backgroundBottom: "#001133"
+    property string fontFamily: ""
+    property string particleSource: "particle.png"
+    property real particleGravity: 0
+
+    // scale factor of the user interface, set from the settings or screenScale; particleScale
+    // is the size of the grid cells relative to the 150 pixels the particle effects are made for
+    property real uiScale: 1
+    property real particleScale: 1
+    // scale for screens with a high pixel density, unless Qt already scales for them
+    readonly property real screenScale: Screen.devicePixelRatio > 1 ? 1 : Math.max(1, Math.round(Screen.pixelDensity * 25.4 / 96 * 4) / 4)
 
-        preventStealing: true
-        acceptedButtons: Qt.LeftButton
+    // copies text to the clipboard, which is not reachable from Go
+    function copyToClipboard(text) {
+        clipboardHelper.text = text
+        clipboardHelper.selectAll()
+        clipboardHelper.copy()
+    }
+    TextEdit { id: clipboardHelper; visible: false }
+
+    // swipes with the mouse or any number of fingers, recognized on the Go side
+    MultiPointTouchArea {
+        anchors.fill: parent
+        mouseEnabled: true
 
-        onPressed: ctrl.handleMouseDown(mouse.x, mouse.y)
-        onReleased: ctrl.handleMouseUp(mouse.x, mouse.y)                
+        onPressed: {
+            for (var i = 0; i < touchPoints.length; i++)
+                ctrl.handlePointerDown(touchPoints[i].pointId, touchPoints[i].x, touchPoints[i].y)
+        }
+        onUpdated: {
+            for (var i = 0; i < touchPoints.length; i++)
+                ctrl.handlePointerMove(touchPoints[i].pointId, touchPoints[i].x, touchPoints[i].y)
+        }
+        onReleased: {
+            for (var i = 0; i < touchPoints.length; i++)
+                ctrl.handlePointerUp(touchPoints[i].pointId, touchPoints[i].x, touchPoints[i].y)
+        }
+        onCanceled: {
+            for (var i = 0; i < touchPoints.length; i++)
+                ctrl.handlePointerCancel(touchPoints[i].pointId)
+        }
     }
 
     gradient: Gradient {
-        GradientStop { position: 0.0; color: "#001166"; }
+        GradientStop { position: 0.0; color: backgroundTop; }
         //GradientStop { position: 0.8; color: "#875864"; }
-        GradientStop { position: 1.0; color: "#001133"; }
+        GradientStop { position: 1.0; color: backgroundBottom; }
     }
 
     SystemPalette { id: activePalette }
     
     Keys.onPressed: ctrl.handleKey(event.key)
+
+    // drives the 3D tile animations, which are computed on the Go side
+    Timer {
+        objectName: "animationTimer"
+        interval: 16
+        repeat: true
+        running: false
+        onTriggered: ctrl.handleAnimationFrame()
+    }
     
     Rectangle {
         id: toolBar
-        width: parent.width; height: 30
+        width: parent.width; height: 30 * uiScale
         color: "yellow"
         anchors.top: screen.top
 
         gradient: Gradient {
-            GradientStop { position: 0.0; color: "#001133"; }
-            GradientStop { position: 1.0; color: "#001166"; }
+            GradientStop { position: 0.0; color: backgroundBottom; }
+            GradientStop { position: 1.0; color: backgroundTop; }
         }
 
         Button {
-            anchors { left: parent.left; leftMargin: 15; verticalCenter: parent.verticalCenter }
+            id: restartButton
+            anchors { left: parent.left; leftMargin: 15 * uiScale; verticalCenter: parent.verticalCenter }
             text: "Restart"
             onClicked: ctrl.handleRestartButton()
         }
 
+        Button {
+            id: themeButton
+            objectName: "themeButton"
+            anchors { left: restartButton.right; leftMargin: 10 * uiScale; verticalCenter: parent.verticalCenter }
+            text: "Theme"
+            onClicked: ctrl.handleThemeButton()
+        }
+
+        Button {
+            id: exportButton
+            anchors { left: themeButton.right; leftMargin: 10 * uiScale; verticalCenter: parent.verticalCenter }
+            text: "Export"
+            onClicked: ctrl.handleExportButton()
+        }
+
+        Button {
+            id: keysButton
+            anchors { left: exportButton.right; leftMargin: 10 * uiScale; verticalCenter: parent.verticalCenter }
+            text: "Keys"
+            onClicked: ctrl.handleBindingsButton()
+        }
+
+        Button {
+            id: editButton
+            anchors { left: keysButton.right; leftMargin: 10 * uiScale; verticalCenter: parent.verticalCenter }
+            text: "Edit"
+            onClicked: ctrl.handleEditButton()
+        }
+
+        Button {
+            anchors { left: editButton.right; leftMargin: 10 * uiScale; verticalCenter: parent.verticalCenter }
+            text: "Modes"
+            onClicked: ctrl.handlePuzzlesButton()
+        }
+
         Text {
             id: score
             objectName: "score"
             color: "white"
-            anchors { right: parent.right; rightMargin: 15; verticalCenter: parent.verticalCenter }
+            font.family: fontFamily
+            font.pixelSize: 13 * uiScale
+            anchors { right: parent.right; rightMargin: 15 * uiScale; verticalCenter: parent.verticalCenter }
             text: "Score: 0"
         }
     }   
     
+    BoardView {
+        id: boardView
+        objectName: "boardView"
+        anchors { top: toolBar.bottom; bottom: parent.bottom; left: parent.left; right: parent.right }
+
+        onXChanged: ctrl.handleResize(x, y, width, height)
+        onYChanged: ctrl.handleResize(x, y, width, height)
+        onWidthChanged: ctrl.handleResize(x, y, width, height)
+        onHeightChanged: ctrl.handleResize(x, y, width, height)
+    }
+
+    // parent of the tiles, whose positions are in window coordinates
     Item {
-        width: parent.width
-        anchors { top: parent.top; bottom: toolBar.top }
+        id: gameCanvas
+        objectName: "gameCanvas"
+        anchors.fill: parent
+    }
 
-        Item {
-            id: gameCanvas
-            objectName: "gameCanvas"
+    Text {
+        id: message
+        objectName: "message"
+        font.pixelSize: Math.max(12, Math.min(boardView.width, boardView.height) / 20)
+        font.family: fontFamily
+        color: "white"
+        z: 100
+        anchors { bottom: boardView.verticalCenter; horizontalCenter: boardView.horizontalCenter }
+        text: "GoFusion"
+    }
+    Glow {
+        anchors.fill: message
+        radius: 8
+        samples: 16
+        color: "white"
+        source: message
+    }
 
-            property int score: 0
-            //property int blockSize: 40
+    Text {
+        id: submessage
+        objectName: "submessage"
+        font.pixelSize: Math.max(10, Math.min(boardView.width, boardView.height) / 34)
+        font.family: fontFamily
+        color: "white"
+        z: 100
+        anchors { top: message.bottom; topMargin: message.font.pixelSize / 2; horizontalCenter: boardView.horizontalCenter }
+        text: "a '2048' clone by nieware"
+    }
+    Glow {
+        anchors.fill: submessage
+        radius: 4
+        samples: 16
+        color: "white"
+        source: submessage
+    }
 
-            width: parent.width //- (parent.width % blockSize)
-            height: parent.height //- (parent.height % blockSize)
+    // board editor: the value selected here is placed on the fields clicked (× removes tiles)
+    Rectangle {
+        id: editorPanel
+        objectName: "editorPanel"
+        property int brush: 0
+        anchors { bottom: parent.bottom; horizontalCenter: parent.horizontalCenter; bottomMargin: 8 * uiScale }
+        width: editorColumn.width + 16 * uiScale; height: editorColumn.height + 16 * uiScale
+        radius: 8
+        color: "#c0000000"
+        visible: false
+        z: 150
+
+        Column {
+            id: editorColumn
             anchors.centerIn: parent
+            spacing: 8 * uiScale
+
+            Row {
+                spacing: 4 * uiScale
+                Repeater {
+                    model: 12
+                    Rectangle {
+                        width: 40 * uiScale; height: 28 * uiScale
+                        radius: 4
+                        color: editorPanel.brush == index ? "#c0c0ff" : "#40ffffff"
+                        Text {
+                            anchors.centerIn: parent
+                            font.pixelSize: 12 * uiScale
+                            font.family: fontFamily
+                            color: editorPanel.brush == index ? "black" : "white"
+                            text: index == 0 ? "×" : (1 << index)
+                        }
+                        MouseArea {
+                            anchors.fill: parent
+                            onClicked: ctrl.handleEditorBrush(index)
+                        }
+                    }
+                }
+            }
+
+            Row {
+                anchors.horizontalCenter: parent.horizontalCenter
+                spacing: 10 * uiScale
+                Button { text: "Clear"; onClicked: ctrl.handleEditorClear() }
+                Button { text: "Load"; onClicked: loadLayoutDialog.open() }
+                Button { text: "Save"; onClicked: saveLayoutDialog.open() }
+                Button { text: "Play"; onClicked: ctrl.handleEditorPlay() }
+            }
         }
+    }
 
-        Text {
-            id: message
-            objectName: "message"
-            font.pointSize: 24
-            color: "white"
-            y: 300 // verticalCenter doesn't work?!
-            z: 100
-            //verticalAlignment: Text.AlignVCenter
-            anchors {
-                //verticalCenter: parent.verticalCenter
-                horizontalCenter: parent.horizontalCenter
-            }
-            text: "GoFusion"
-        }
-        Glow {
-            anchors.fill: message
-            radius: 8
-            samples: 16
-            color: "white"
-            source: message
+    FileDialog {
+        id: loadLayoutDialog
+        title: "Load board layout"
+        nameFilters: [ "Board layouts (*.board)", "All files (*)" ]
+        onAccepted: ctrl.handleEditorLoad(fileUrl.toString())
+    }
+
+    FileDialog {
+        id: saveLayoutDialog
+        title: "Save board layout"
+        selectExisting: false
+        nameFilters: [ "Board layouts (*.board)", "All files (*)" ]
+        onAccepted: ctrl.handleEditorSave(fileUrl.toString())
+    }
+
+    // level select screen of the puzzle mode
+    Rectangle {
+        id: levelScreen
+        objectName: "levelScreen"
+        anchors.fill: boardView
+        color: "#c0000000"
+        visible: false
+        z: 200
+
+        // don't let clicks through to the board
+        MouseArea { anchors.fill: parent }
+
+        Column {
+            anchors.centerIn: parent
+            spacing: 6 * uiScale
+
+            Text {
+                anchors.horizontalCenter: parent.horizontalCenter
+                font.pixelSize: 20 * uiScale
+                font.family: fontFamily
+                color: "white"
+                text: "Game modes"
+            }
+
+            Flickable {
+                width: 460 * uiScale; height: Math.min(levelColumn.height, levelScreen.height - 120 * uiScale)
+                contentHeight: levelColumn.height
+                clip: true
+
+                Column {
+                    id: levelColumn
+                    Repeater {
+                        objectName: "levelList"
+                        model: 0
+                        Rectangle {
+                            property bool locked: levelStatus.text == "locked"
+                            width: 460 * uiScale; height: levelLabel.height + levelStatus.height + 8 * uiScale
+                            radius: 4
+                            color: levelMouse.containsMouse && !locked ? "#40ffffff" : "transparent"
+
+                            Text {
+                                id: levelLabel
+                                x: 8 * uiScale; y: 4 * uiScale
+                                font.pixelSize: 14 * uiScale
+                                font.family: fontFamily
+                                color: locked ? "gray" : "white"
+                                text: ctrl.levelLabel(index)
+                            }
+                            Text {
+                                id: levelStatus
+                                x: 24 * uiScale; anchors.top: levelLabel.bottom
+                                font.pixelSize: 11 * uiScale
+                                font.family: fontFamily
+                                color: locked ? "gray" : "#c0c0ff"
+                                text: ctrl.levelStatus(index)
+                            }
+                            MouseArea {
+                                id: levelMouse
+                                anchors.fill: parent
+                                hoverEnabled: true
+                                onClicked: ctrl.handleLevelClicked(index)
+                            }
+                        }
+                    }
+                }
+            }
+
+            Grid {
+                anchors.horizontalCenter: parent.horizontalCenter
+                columns: 3
+                spacing: 10 * uiScale
+                Button {
+                    text: "Classic game"
+                    onClicked: ctrl.handleClassicGame()
+                }
+                Button {
+                    objectName: "ruleButton"
+                    text: "Rules: Classic"
+                    onClicked: ctrl.handleRuleButton()
+                }
+                Button {
+                    text: "Special tiles"
+                    onClicked: ctrl.handleSpecialsButton()
+                }
+                Button {
+                    text: "Hex board"
+                    onClicked: ctrl.handleHexButton()
+                }
+                Button {
+                    text: "Daily challenge"
+                    onClicked: ctrl.handleDailyButton()
+                }
+                Button {
+                    text: "Share daily"
+                    onClicked: ctrl.handleShareButton()
+                }
+                Button {
+                    text: "Versus"
+                    onClicked: ctrl.handleVersusButton()
+                }
+                Button {
+                    text: "Attack"
+                    onClicked: ctrl.handleAttackButton()
+                }
+                Button {
+                    text: "Online"
+                    onClicked: ctrl.handleOnlineButton()
+                }
+                Button {
+                    text: "Close"
+                    onClicked: ctrl.handlePuzzlesButton()
+                }
+            }
         }
+    }
 
+    // versus game: the boards of both players side by side, painted from the Go side
+    Rectangle {
+        id: versusScreen
+        objectName: "versusScreen"
+        property string message: ""
+        property string submessage: ""
+        // online, the opponent's board on the right is shown smaller
+        property bool online: false
+        anchors.fill: boardView
+        visible: false
+        z: 150
 
-        Text {
-            id: submessage
-            objectName: "submessage"
-            font.pointSize: 14
-            color: "white"
-            y: 350 // verticalCenter doesn't work?!
-            z: 100
-            //verticalAlignment: Text.AlignVCenter
-            anchors {
-                //verticalCenter: parent.verticalCenter
-                horizontalCenter: parent.horizontalCenter
-            }
-            text: "a '2048' clone by nieware"
-        }
-        Glow {
-            anchors.fill: submessage
-            radius: 4
-            samples: 16
-            color: "white"
-            source: submessage
-        }        
+        gradient: Gradient {
+            GradientStop { position: 0.0; color: backgroundTop; }
+            GradientStop { position: 1.0; color: backgroundBottom; }
+        }
+
+        // don't let clicks and swipes through to the main board
+        MouseArea { anchors.fill: parent }
+
+        Row {
+            id: versusBoards
+            anchors { top: parent.top; topMargin: 10 * uiScale; horizontalCenter: parent.horizontalCenter }
+            spacing: 10 * uiScale
+
+            Repeater {
+                model: 2
+                Column {
+                    spacing: 4 * uiScale
+                    Text {
+                        objectName: "versusScore" + (index + 1)
+                        anchors.horizontalCenter: parent.horizontalCenter
+                        font.pixelSize: 14 * uiScale
+                        font.family: fontFamily
+                        color: "white"
+                        text: "Player " + (index + 1)
+                    }
+                    BoardView {
+                        objectName: "versusView" + (index + 1)
+                        player: index + 1
+                        width: (versusScreen.width - 30 * uiScale) / (versusScreen.online ? (index == 0 ? 1.5 : 3) : 2)
+                        height: Math.min(width, versusScreen.height - 140 * uiScale)
+                    }
+                }
+            }
+        }
+
+        Column {
+            anchors { top: versusBoards.bottom; topMargin: 10 * uiScale; horizontalCenter: parent.horizontalCenter }
+            spacing: 6 * uiScale
+
+            Text {
+                anchors.horizontalCenter: parent.horizontalCenter
+                font.pixelSize: 18 * uiScale
+                font.family: fontFamily
+                color: "white"
+                text: versusScreen.message
+            }
+            Text {
+                anchors.horizontalCenter: parent.horizontalCenter
+                font.pixelSize: 12 * uiScale
+                font.family: fontFamily
+                color: "#c0c0ff"
+                text: versusScreen.submessage
+            }
+            Button {
+                anchors.horizontalCenter: parent.horizontalCenter
+                text: "Close"
+                onClicked: ctrl.handleVersusClose()
+            }
+        }
+    }
+
+    // lists the actions and their keys; clicking an action assigns the next key pressed to it
+    Rectangle {
+        id: bindingsScreen
+        objectName: "bindingsScreen"
+        property string prompt: ""
+        anchors.fill: boardView
+        color: "#c0000000"
+        visible: false
+        z: 200
+
+        // don't let clicks through to the board
+        MouseArea { anchors.fill: parent }
+
+        Column {
+            anchors.centerIn: parent
+            spacing: 6 * uiScale
+
+            Text {
+                anchors.horizontalCenter: parent.horizontalCenter
+                font.pixelSize: 20 * uiScale
+                font.family: fontFamily
+                color: "white"
+                text: "Key Bindings"
+            }
+
+            Repeater {
+                objectName: "bindingsList"
+                model: 0
+                Rectangle {
+                    width: 420 * uiScale; height: actionLabel.height + 6 * uiScale
+                    radius: 4
+                    color: rowMouse.containsMouse ? "#40ffffff" : "transparent"
+
+                    Text {
+                        id: actionLabel
+                        x: 8 * uiScale
+                        anchors.verticalCenter: parent.verticalCenter
+                        font.pixelSize: 14 * uiScale
+                        font.family: fontFamily
+                        color: "white"
+                        text: ctrl.bindingLabel(index)
+                    }
+                    Text {
+                        x: 160 * uiScale
+                        anchors.verticalCenter: parent.verticalCenter
+                        font.pixelSize: 14 * uiScale
+                        font.family: fontFamily
+                        color: "#c0c0ff"
+                        text: ctrl.bindingKeys(index)
+                    }
+                    MouseArea {
+                        id: rowMouse
+                        anchors.fill: parent
+                        hoverEnabled: true
+                        onClicked: ctrl.handleBindingClicked(index)
+                    }
+                }
+            }
+
+            Text {
+                anchors.horizontalCenter: parent.horizontalCenter
+                font.pixelSize: 12 * uiScale
+                font.family: fontFamily
+                color: "yellow"
+                text: bindingsScreen.prompt
+            }
+
+            Row {
+                anchors.horizontalCenter: parent.horizontalCenter
+                spacing: 10 * uiScale
+                Button {
+                    text: "Reset"
+                    onClicked: ctrl.handleBindingsReset()
+                }
+                Button {
+                    text: "Close"
+                    onClicked: ctrl.handleBindingsClose()
+                }
+            }
+        }
     }
 
 	property var tileComponent: Component {
 		id: tileComponent
-		Tile {
+		// tiles are painted by the board view, which takes their position, size and opacity
+		Item {
 			id: tile
             property int nvalue: 1
             property int zOrder: 0
+            // position changes are animated unless the Go side places the tile instantly
+            property bool animate: true
 
             property real bounceY0: 0
             property real bounceY1: 0
@@ -136,7 +552,13 @@ Rectangle {
 
             x: 300; y: 300; z: zOrder
 			width: 0; height: 0
+
+            onXChanged: boardView.update()
+            onYChanged: boardView.update()
+            onWidthChanged: boardView.update()
+            onOpacityChanged: boardView.update()
             Behavior on x  {
+                enabled: animate
                 NumberAnimation  { duration: 500; easing.type: Easing.OutBounce; 
                     onRunningChanged: {
                         if (!running) {
@@ -146,6 +568,7 @@ Rectangle {
                 }
             }
             Behavior on y  {
+                enabled: animate
                 NumberAnimation  { duration: 500; easing.type: Easing.OutBounce; 
                     onRunningChanged: {
                         if (!running) {
@@ -171,7 +594,7 @@ Rectangle {
 
             NumberAnimation on y {
                 running: fallEnable
-                to: 2000; duration: fallDuration; easing.type: "OutQuad"
+                to: screen.height + tile.height; duration: fallDuration; easing.type: "OutQuad"
                 onRunningChanged: {
                     if (!running) {
                         ctrl.handleFallAnimationDone();
@@ -186,12 +609,28 @@ Rectangle {
 
     ImageParticle {
         system: sys
-        source: "particle.png"
+        source: particleSource
         color: "white"
         colorVariation: 1.0
         alpha: 0.1
     }
 
+    // particle painters for sparks of a single color, created per color by the Go side
+    property var particlePainterComponent: Component {
+        ImageParticle {
+            system: sys
+            source: particleSource
+            colorVariation: 0.1
+            alpha: 0.1
+        }
+    }
+
+    Gravity {
+        system: sys
+        angle: 90
+        magnitude: particleGravity
+    }
+
     property var emitterComponent: Component {
         id: emitterComponent
         Emitter {
@@ -199,11 +638,12 @@ Rectangle {
             system: sys
             Emitter {
                 system: sys
+                group: container.group
                 emitRate: 128
                 lifeSpan: 600
-                size: 16
-                endSize: 8
-                velocity: AngleDirection { angleVariation:360; magnitude: 60 }
+                size: 16 * particleScale
+                endSize: 8 * particleScale
+                velocity: AngleDirection { angleVariation:360; magnitude: 60 * particleScale }
             }
 
             property int life: 2600
@@ -211,8 +651,8 @@ Rectangle {
             property real targetY: 0
             emitRate: 128
             lifeSpan: 600
-            size: 24
-            endSize: 8
+            size: 24 * particleScale
+            endSize: 8 * particleScale
             NumberAnimation on x {
                 objectName: "xAnim"
                 id: xAnim;
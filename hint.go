@@ -0,0 +1,33 @@
+package main
+
+// clone returns a simulated copy of the board, without QML objects and random generator,
+// for trying out moves
+func (b *Board) clone() *Board {
+	c := &Board{width: b.width, height: b.height, hex: b.hex, score: b.score, rule: b.rule}
+	c.tiles = make([]*Tile, len(b.tiles))
+	for i, t := range b.tiles {
+		if t != nil {
+			c.tiles[i] = &Tile{x: t.x, y: t.y, value: t.value, kind: t.kind}
+		}
+	}
+	return c
+}
+
+// bestMove suggests a move: the one which leaves the most free fields, counting the points
+// scored as a tie-breaker. It returns false if no move is possible.
+func (b *Board) bestMove() (dir byte, ok bool) {
+	best := -1
+	for _, d := range []byte(b.topology().directions()) {
+		c := b.clone()
+		c.move(d)
+		if !c.moved {
+			continue
+		}
+		c.doMerge()
+		rating := c.freeSpaces(nil)*1000 + c.score - b.score
+		if rating > best {
+			best, dir, ok = rating, d, true
+		}
+	}
+	return
+}
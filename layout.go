@@ -0,0 +1,169 @@
+package main
+
+// referenceGrid is the size of a grid cell in pixels which the animations and particle effects
+// are designed for; they are scaled by the actual size of the cells
+const referenceGrid = 150
+
+// default size of the window at a scale of 1, fitting a 4x4 board of referenceGrid sized cells
+// below the tool bar
+const defaultWindowWidth, defaultWindowHeight = 600, 675
+
+// values of the "visibility" property of QML windows (QWindow::Visibility)
+const (
+	visibilityWindowed   = 2
+	visibilityFullScreen = 5
+)
+
+// layout holds the position and size of the board's grid on screen. The grid is as large as
+// possible while still fitting into the board view, and centered in it.
+type layout struct {
+	x0, y0 int      // top left corner of the grid
+	grid   int      // size of a grid cell
+	tile   int      // size of a tile
+	topo   topology // places the cells on the grid
+}
+
+// newLayout computes the layout for a board of the given topology shown in the given area
+func newLayout(x, y, width, height int, topo topology) layout {
+	bw, bh := topo.extent()
+	grid := int(float32(width) / bw)
+	if h := int(float32(height) / bh); h < grid {
+		grid = h
+	}
+	if grid < 1 {
+		grid = 1
+	}
+	return layout{
+		x0:   x + (width-int(float32(grid)*bw))/2,
+		y0:   y + (height-int(float32(grid)*bh))/2,
+		grid: grid,
+		tile: grid,
+		topo: topo,
+	}
+}
+
+// pos returns the position of the top left corner of the tile at field x, y
+func (l layout) pos(x, y int) (int, int) {
+	if l.topo == nil {
+		return l.x0 + l.grid*x, l.y0 + l.grid*y
+	}
+	px, py := l.topo.pos(x, y)
+	return l.x0 + int(float32(l.grid)*px+0.5), l.y0 + int(float32(l.grid)*py+0.5)
+}
+
+// center returns the position of the center of field x, y
+func (l layout) center(x, y int) (int, int) {
+	px, py := l.pos(x, y)
+	return px + l.grid/2, py + l.grid/2
+}
+
+// scale returns the size of the grid cells relative to referenceGrid
+func (l layout) scale() float64 {
+	return float64(l.grid) / referenceGrid
+}
+
+// HandleResize is called by the board view when its geometry changes. It recomputes the layout
+// and moves all tiles to their new positions (without animation).
+func (ctrl *Control) HandleResize(x, y, width, height int) {
+	if width <= 0 || height <= 0 || board.width == 0 {
+		return
+	}
+	ctrl.layout = newLayout(x, y, width, height, board.topology())
+	ctrl.Root.Set("particleScale", ctrl.layout.scale())
+	ctrl.instant = true
+	defer func() { ctrl.instant = false }()
+	for _, t := range board.tiles {
+		if t == nil || t.Object == nil {
+			continue
+		}
+		t.Set("width", ctrl.layout.tile)
+		t.Set("height", ctrl.layout.tile)
+		t.SetPos(t.x, t.y)
+		if t.Bool("bounceEnable") {
+			t.SetBounce(true)
+		}
+	}
+}
+
+// relayout recomputes the layout for the current size of the board view, e.g. when the shape
+// of the board changes
+func (ctrl *Control) relayout() {
+	ctrl.HandleResize(ctrl.BoardView.Int("x"), ctrl.BoardView.Int("y"), ctrl.BoardView.Int("width"), ctrl.BoardView.Int("height"))
+}
+
+// uiScale returns the scale factor of the user interface: the one from the settings, or the
+// one QML derived from the pixel density of the screen
+func (ctrl *Control) uiScale() float64 {
+	if ctrl.settings != nil {
+		if s := ctrl.settings.GetScale(); s > 0 {
+			return s
+		}
+	}
+	if s := ctrl.Root.Float64("screenScale"); s > 0 {
+		return s
+	}
+	return 1
+}
+
+// initWindow sets the scale of the user interface and restores the window geometry saved
+// in the settings, or gives the window its default size
+func (ctrl *Control) initWindow(fullscreen bool) {
+	scale := ctrl.uiScale()
+	ctrl.Root.Set("uiScale", scale)
+
+	var geom *WindowGeometry
+	if ctrl.settings != nil {
+		geom = ctrl.settings.GetWindow()
+	}
+	if geom != nil && geom.Width > 0 && geom.Height > 0 {
+		ctrl.Window.Set("x", geom.X)
+		ctrl.Window.Set("y", geom.Y)
+		ctrl.Window.Set("width", geom.Width)
+		ctrl.Window.Set("height", geom.Height)
+		fullscreen = fullscreen || geom.Fullscreen
+	} else {
+		ctrl.Window.Set("width", int(defaultWindowWidth*scale))
+		ctrl.Window.Set("height", int(defaultWindowHeight*scale))
+	}
+	ctrl.setFullscreen(fullscreen)
+}
+
+// setFullscreen switches the window between fullscreen and windowed mode
+func (ctrl *Control) setFullscreen(v bool) {
+	if v {
+		if !ctrl.fullscreen {
+			// remember the geometry to return to
+			g := ctrl.windowGeometry()
+			ctrl.windowed = &g
+		}
+		ctrl.Window.Set("visibility", visibilityFullScreen)
+	} else {
+		ctrl.Window.Set("visibility", visibilityWindowed)
+	}
+	ctrl.fullscreen = v
+}
+
+// windowGeometry returns the current position and size of the window
+func (ctrl *Control) windowGeometry() WindowGeometry {
+	return WindowGeometry{
+		X:      ctrl.Window.Int("x"),
+		Y:      ctrl.Window.Int("y"),
+		Width:  ctrl.Window.Int("width"),
+		Height: ctrl.Window.Int("height"),
+	}
+}
+
+// saveWindow stores the window geometry in the settings, so the next game starts with the
+// window where it was left. In fullscreen mode, the geometry of the window before switching
+// to fullscreen is kept.
+func (ctrl *Control) saveWindow() {
+	if ctrl.settings == nil {
+		return
+	}
+	g := ctrl.windowGeometry()
+	if ctrl.fullscreen && ctrl.windowed != nil {
+		g = *ctrl.windowed
+	}
+	g.Fullscreen = ctrl.fullscreen
+	ctrl.settings.SetWindow(g)
+}
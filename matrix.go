@@ -0,0 +1,106 @@
+package main
+
+import "math"
+
+// mat4 is a 4x4 transformation matrix in column-major order, as used by OpenGL
+type mat4 [16]float32
+
+// identity returns the identity matrix
+func identity() mat4 {
+	return mat4{
+		1, 0, 0, 0,
+		0, 1, 0, 0,
+		0, 0, 1, 0,
+		0, 0, 0, 1,
+	}
+}
+
+// mul returns the product m*n, i.e. the transformation n followed by m
+func (m mat4) mul(n mat4) mat4 {
+	var r mat4
+	for c := 0; c < 4; c++ {
+		for row := 0; row < 4; row++ {
+			var s float32
+			for k := 0; k < 4; k++ {
+				s += m[k*4+row] * n[c*4+k]
+			}
+			r[c*4+row] = s
+		}
+	}
+	return r
+}
+
+// translate returns m multiplied by a translation (like glTranslatef)
+func (m mat4) translate(x, y, z float32) mat4 {
+	t := identity()
+	t[12], t[13], t[14] = x, y, z
+	return m.mul(t)
+}
+
+// scale returns m multiplied by a scaling (like glScalef)
+func (m mat4) scale(x, y, z float32) mat4 {
+	s := identity()
+	s[0], s[5], s[10] = x, y, z
+	return m.mul(s)
+}
+
+// rotate returns m multiplied by a rotation by angle degrees around the axis (x, y, z)
+// (like glRotatef)
+func (m mat4) rotate(angle, x, y, z float32) mat4 {
+	l := float32(math.Sqrt(float64(x*x + y*y + z*z)))
+	if l == 0 {
+		return m
+	}
+	x, y, z = x/l, y/l, z/l
+	rad := float64(angle) * math.Pi / 180
+	c, s := float32(math.Cos(rad)), float32(math.Sin(rad))
+	ic := 1 - c
+	r := mat4{
+		x*x*ic + c, y*x*ic + z*s, x*z*ic - y*s, 0,
+		x*y*ic - z*s, y*y*ic + c, y*z*ic + x*s, 0,
+		x*z*ic + y*s, y*z*ic - x*s, z*z*ic + c, 0,
+		0, 0, 0, 1,
+	}
+	return m.mul(r)
+}
+
+// transformPoint applies m to the point p
+func (m mat4) transformPoint(p [3]float32) [3]float32 {
+	var r [4]float32
+	for row := 0; row < 4; row++ {
+		r[row] = m[row]*p[0] + m[4+row]*p[1] + m[8+row]*p[2] + m[12+row]
+	}
+	if r[3] != 0 && r[3] != 1 {
+		return [3]float32{r[0] / r[3], r[1] / r[3], r[2] / r[3]}
+	}
+	return [3]float32{r[0], r[1], r[2]}
+}
+
+// transformNormal applies the rotational part of m to the normal n and normalizes the result.
+// (This is only correct for matrices without non-uniform scaling, which is all we use.)
+func (m mat4) transformNormal(n [3]float32) [3]float32 {
+	var r [3]float32
+	for row := 0; row < 3; row++ {
+		r[row] = m[row]*n[0] + m[4+row]*n[1] + m[8+row]*n[2]
+	}
+	return normalize(r)
+}
+
+// normalize returns v scaled to unit length
+func normalize(v [3]float32) [3]float32 {
+	l := float32(math.Sqrt(float64(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])))
+	if l == 0 {
+		return v
+	}
+	return [3]float32{v[0] / l, v[1] / l, v[2] / l}
+}
+
+// frustum returns a perspective projection matrix (like glFrustum)
+func frustum(left, right, bottom, top, near, far float32) mat4 {
+	return mat4{
+		2 * near / (right - left), 0, 0, 0,
+		0, 2 * near / (top - bottom), 0, 0,
+		(right + left) / (right - left), (top + bottom) / (top - bottom), -(far + near) / (far - near), -1,
+		0, 0, -2 * far * near / (far - near), 0,
+	}
+}
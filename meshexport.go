@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sortedObjects returns the objects sorted by name, so exported files are reproducible
+func sortedObjects(objects map[string]*Object) []*Object {
+	var names []string
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sorted []*Object
+	for _, name := range names {
+		sorted = append(sorted, objects[name])
+	}
+	return sorted
+}
+
+// materialName returns the name under which a material is exported
+func materialName(m *Material) string {
+	if m == nil || m.Name == "" {
+		return "default"
+	}
+	return m.Name
+}
+
+// Write writes the objects to an OBJ file and their materials to an MTL file next to it
+// (with the same base name and the extension ".mtl").
+func Write(filename string, objects map[string]*Object) error {
+	mtlName := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)) + ".mtl"
+
+	err := writeFile(filepath.Join(filepath.Dir(filename), mtlName), func(w io.Writer) error {
+		return WriteMTL(w, objects)
+	})
+	if err != nil {
+		return err
+	}
+	return writeFile(filename, func(w io.Writer) error {
+		return WriteOBJ(w, mtlName, objects)
+	})
+}
+
+// writeFile creates a file and passes a buffered writer for it to write
+func writeFile(filename string, write func(w io.Writer) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := write(bw); err != nil {
+		f.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteOBJ writes the objects in OBJ format. mtlLib is the name of the material library
+// referenced by the file (may be empty). Identical vertexes and normals are only written once.
+func WriteOBJ(w io.Writer, mtlLib string, objects map[string]*Object) error {
+	ew := &errWriter{w: w}
+	ew.printf("# GoFusion OBJ File\n")
+	if mtlLib != "" {
+		ew.printf("mtllib %s\n", mtlLib)
+	}
+
+	vertexes := make(map[[3]float32]int)
+	normals := make(map[[3]float32]int)
+	index := func(m map[[3]float32]int, keyword string, c []float32) int {
+		k := [3]float32{c[0], c[1], c[2]}
+		i, ok := m[k]
+		if !ok {
+			i = len(m) + 1
+			m[k] = i
+			ew.printf("%s %s %s %s\n", keyword, formatFloat(c[0]), formatFloat(c[1]), formatFloat(c[2]))
+		}
+		return i
+	}
+
+	for _, obj := range sortedObjects(objects) {
+		ew.printf("o %s\n", obj.Name)
+		for _, group := range obj.Groups {
+			// write the vertex data first, so it is defined before the faces referencing it
+			vi := make([]int, len(group.Vertexes)/3)
+			ni := make([]int, len(group.Vertexes)/3)
+			for i := range vi {
+				vi[i] = index(vertexes, "v", group.Vertexes[i*3:])
+				if i*3+2 < len(group.Normals) {
+					ni[i] = index(normals, "vn", group.Normals[i*3:])
+				}
+			}
+			li := make([]int, len(group.Lines)/3)
+			for i := range li {
+				li[i] = index(vertexes, "v", group.Lines[i*3:])
+			}
+
+			// always start a group, so unnamed groups don't get the name of the previous one
+			if group.Name != "" {
+				ew.printf("g %s\n", group.Name)
+			} else {
+				ew.printf("g\n")
+			}
+			ew.printf("usemtl %s\n", materialName(group.Material))
+			ew.printf("s off\n")
+			for f := 0; f+2 < len(vi); f += 3 {
+				if ni[f] > 0 && ni[f+1] > 0 && ni[f+2] > 0 {
+					ew.printf("f %d//%d %d//%d %d//%d\n", vi[f], ni[f], vi[f+1], ni[f+1], vi[f+2], ni[f+2])
+				} else {
+					ew.printf("f %d %d %d\n", vi[f], vi[f+1], vi[f+2])
+				}
+			}
+			for l := 0; l+1 < len(li); l += 2 {
+				ew.printf("l %d %d\n", li[l], li[l+1])
+			}
+		}
+	}
+	return ew.err
+}
+
+// WriteMTL writes the materials used by the objects in MTL format
+func WriteMTL(w io.Writer, objects map[string]*Object) error {
+	ew := &errWriter{w: w}
+	ew.printf("# GoFusion MTL File\n")
+
+	written := make(map[string]bool)
+	for _, obj := range sortedObjects(objects) {
+		for _, group := range obj.Groups {
+			name := materialName(group.Material)
+			if written[name] {
+				continue
+			}
+			written[name] = true
+
+			m := group.Material
+			if m == nil {
+				m = newMaterial(name)
+			}
+			ew.printf("\nnewmtl %s\n", name)
+			ew.printf("Ns %s\n", formatFloat(m.Shininess/128*1000))
+			ew.printf("Ka %s %s %s\n", formatFloat(m.Ambient[0]), formatFloat(m.Ambient[1]), formatFloat(m.Ambient[2]))
+			ew.printf("Kd %s %s %s\n", formatFloat(m.Diffuse[0]), formatFloat(m.Diffuse[1]), formatFloat(m.Diffuse[2]))
+			ew.printf("Ks %s %s %s\n", formatFloat(m.Specular[0]), formatFloat(m.Specular[1]), formatFloat(m.Specular[2]))
+			ew.printf("d %s\n", formatFloat(m.Diffuse[3]))
+			ew.printf("illum 2\n")
+		}
+	}
+	return ew.err
+}
+
+// WriteSTL writes the triangles of the objects in STL format, either binary or ASCII.
+// STL has no notion of materials or vertex normals, so only the geometry is written;
+// facet normals are calculated from the vertexes.
+func WriteSTL(w io.Writer, name string, objects map[string]*Object, ascii bool) error {
+	var triangles [][]float32
+	for _, obj := range sortedObjects(objects) {
+		for _, group := range obj.Groups {
+			for f := 0; f+9 <= len(group.Vertexes); f += 9 {
+				triangles = append(triangles, group.Vertexes[f:f+9])
+			}
+		}
+	}
+
+	if ascii {
+		ew := &errWriter{w: w}
+		ew.printf("solid %s\n", name)
+		for _, t := range triangles {
+			n := faceNormal(t)
+			ew.printf("  facet normal %s %s %s\n", formatFloat(n[0]), formatFloat(n[1]), formatFloat(n[2]))
+			ew.printf("    outer loop\n")
+			for c := 0; c < 9; c += 3 {
+				ew.printf("      vertex %s %s %s\n", formatFloat(t[c]), formatFloat(t[c+1]), formatFloat(t[c+2]))
+			}
+			ew.printf("    endloop\n")
+			ew.printf("  endfacet\n")
+		}
+		ew.printf("endsolid %s\n", name)
+		return ew.err
+	}
+
+	// binary: 80 byte header, number of triangles, then 50 bytes per triangle
+	var header [80]byte
+	copy(header[:], "GoFusion STL: "+name)
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(triangles))); err != nil {
+		return err
+	}
+	buf := make([]byte, 50)
+	for _, t := range triangles {
+		n := faceNormal(t)
+		for i, v := range append(n[:], t...) {
+			binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+		}
+		// attribute byte count stays 0
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFloat formats a coordinate compactly, without losing precision
+func formatFloat(f float32) string {
+	return fmt.Sprint(f)
+}
+
+// errWriter remembers the first error when writing, so we don't have to check every line
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, a ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, a...)
+	}
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	var n int
+	n, ew.err = ew.w.Write(p)
+	return n, ew.err
+}
+
+// transformObject returns a copy of the object with all vertexes transformed by m
+func transformObject(obj *Object, name string, m mat4) *Object {
+	res := &Object{Name: name}
+	for _, group := range obj.Groups {
+		g := &Group{Name: group.Name, Material: group.Material}
+		for i := 0; i+2 < len(group.Vertexes); i += 3 {
+			p := m.transformPoint([3]float32{group.Vertexes[i], group.Vertexes[i+1], group.Vertexes[i+2]})
+			g.Vertexes = append(g.Vertexes, p[0], p[1], p[2])
+		}
+		for i := 0; i+2 < len(group.Normals); i += 3 {
+			n := m.transformNormal([3]float32{group.Normals[i], group.Normals[i+1], group.Normals[i+2]})
+			g.Normals = append(g.Normals, n[0], n[1], n[2])
+		}
+		for i := 0; i+2 < len(group.Lines); i += 3 {
+			p := m.transformPoint([3]float32{group.Lines[i], group.Lines[i+1], group.Lines[i+2]})
+			g.Lines = append(g.Lines, p[0], p[1], p[2])
+		}
+		res.Groups = append(res.Groups, g)
+	}
+	return res
+}
+
+// boxGroup creates a group containing an axis-aligned box
+func boxGroup(min, max [3]float32, material *Material) *Group {
+	g := &Group{Name: "base", Material: material}
+	// corners of each side, counter-clockwise seen from outside, and the side's normal
+	sides := []struct {
+		n [3]float32
+		c [4][3]float32
+	}{
+		{[3]float32{0, 0, -1}, [4][3]float32{{min[0], min[1], min[2]}, {min[0], max[1], min[2]}, {max[0], max[1], min[2]}, {max[0], min[1], min[2]}}},
+		{[3]float32{0, 0, 1}, [4][3]float32{{min[0], min[1], max[2]}, {max[0], min[1], max[2]}, {max[0], max[1], max[2]}, {min[0], max[1], max[2]}}},
+		{[3]float32{0, -1, 0}, [4][3]float32{{min[0], min[1], min[2]}, {max[0], min[1], min[2]}, {max[0], min[1], max[2]}, {min[0], min[1], max[2]}}},
+		{[3]float32{0, 1, 0}, [4][3]float32{{min[0], max[1], min[2]}, {min[0], max[1], max[2]}, {max[0], max[1], max[2]}, {max[0], max[1], min[2]}}},
+		{[3]float32{-1, 0, 0}, [4][3]float32{{min[0], min[1], min[2]}, {min[0], min[1], max[2]}, {min[0], max[1], max[2]}, {min[0], max[1], min[2]}}},
+		{[3]float32{1, 0, 0}, [4][3]float32{{max[0], min[1], min[2]}, {max[0], max[1], min[2]}, {max[0], max[1], max[2]}, {max[0], min[1], max[2]}}},
+	}
+	for _, s := range sides {
+		for _, k := range []int{0, 1, 2, 0, 2, 3} {
+			g.Vertexes = append(g.Vertexes, s.c[k][0], s.c[k][1], s.c[k][2])
+			g.Normals = append(g.Normals, s.n[0], s.n[1], s.n[2])
+		}
+	}
+	return g
+}
+
+// boardMesh combines the models of all tiles on the board into one object, placed on a
+// base plate so the result can be 3D printed. One unit corresponds to a third of a tile;
+// the board lies in the x-y plane with the tiles facing up (+z).
+func (b *Board) boardMesh(theme *Theme) *Object {
+	res := &Object{Name: "board"}
+
+	// the board lies in the x-y plane with its top left corner at the origin
+	for _, t := range b.tiles {
+		if t == nil {
+			continue
+		}
+		s := b.tileState(t)
+		model, nvalue := s.model(theme)
+		m := tileMatrix(theme, s.x, s.y, 1, 0, 0, nvalue, t.Rotation)
+		for _, obj := range sortedObjects(model) {
+			res.Groups = append(res.Groups, transformObject(obj, obj.Name, m).Groups...)
+		}
+	}
+
+	// put the base plate right below the lowest point of the tiles
+	minZ := float32(0)
+	for _, g := range res.Groups {
+		for i := 2; i < len(g.Vertexes); i += 3 {
+			if g.Vertexes[i] < minZ {
+				minZ = g.Vertexes[i]
+			}
+		}
+	}
+	w, h := float32(cellSize*b.width), float32(cellSize*b.height)
+	base := newMaterial("base")
+	res.Groups = append(res.Groups, boxGroup([3]float32{0, -h, minZ - 0.3}, [3]float32{w, 0, minZ}, base))
+	return res
+}
+
+// exportBoard writes the board as 3D mesh to the given file. The format is chosen by the
+// extension: ".obj" (with an accompanying ".mtl" file) or ".stl" (binary).
+func (b *Board) exportBoard(filename string, theme *Theme) error {
+	objects := map[string]*Object{"board": b.boardMesh(theme)}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".obj":
+		return Write(filename, objects)
+	case ".stl":
+		return writeFile(filename, func(w io.Writer) error {
+			return WriteSTL(w, "board", objects, false)
+		})
+	}
+	return fmt.Errorf("unsupported mesh format %q", filepath.Ext(filename))
+}
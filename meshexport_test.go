@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// testObjects returns objects covering the features of the exporter: several objects and
+// groups, shared vertexes, named and unnamed groups, materials and lines
+func testObjects() map[string]*Object {
+	red := newMaterial("red")
+	red.Diffuse = []float32{1, 0, 0, 1}
+	blue := newMaterial("blue")
+	blue.Ambient = []float32{0.1, 0.1, 0.1, 0.75}
+	blue.Diffuse = []float32{0, 0, 0.5, 0.75}
+	blue.Specular = []float32{0.5, 0.5, 0.5, 0.75}
+	blue.Shininess = 64
+
+	top := &Group{Name: "top", Material: blue,
+		Vertexes: []float32{0, 0, 1, 1, 0, 1, 1, 1, 1, 0, 0, 1, 1, 1, 1, 0, 1, 1},
+		Normals:  []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1},
+	}
+	outline := &Group{Material: red, Lines: []float32{0, 0, 1, 1, 0, 1, 1, 0, 1, 0.25, 0.5, 1}}
+	return map[string]*Object{
+		"base": {Name: "base", Groups: []*Group{boxGroup([3]float32{0, 0, 0}, [3]float32{1, 1, 0.5}, red)}},
+		"tile": {Name: "tile", Groups: []*Group{top, outline}},
+	}
+}
+
+func equalFloats(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWriteOBJRoundTrip(t *testing.T) {
+	objects := testObjects()
+	var obj, mtl bytes.Buffer
+	if err := WriteOBJ(&obj, "test.mtl", objects); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMTL(&mtl, objects); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := readString(obj.String(), map[string]string{"test.mtl": mtl.String()})
+	if err != nil {
+		t.Fatalf("cannot read exported file: %v\n%s", err, obj.String())
+	}
+	if len(read) != len(objects) {
+		t.Fatalf("got %d objects, want %d", len(read), len(objects))
+	}
+	for name, want := range objects {
+		got := read[name]
+		if got == nil {
+			t.Errorf("object %q missing", name)
+			continue
+		}
+		if len(got.Groups) != len(want.Groups) {
+			t.Errorf("object %q: got %d groups, want %d", name, len(got.Groups), len(want.Groups))
+			continue
+		}
+		for i, wg := range want.Groups {
+			gg := got.Groups[i]
+			if gg.Name != wg.Name {
+				t.Errorf("object %q group %d: got name %q, want %q", name, i, gg.Name, wg.Name)
+			}
+			gm, wm := gg.Material, wg.Material
+			if gm.Name != wm.Name || !equalFloats(gm.Ambient, wm.Ambient) || !equalFloats(gm.Diffuse, wm.Diffuse) ||
+				!equalFloats(gm.Specular, wm.Specular) || gm.Shininess != wm.Shininess {
+				t.Errorf("object %q group %d: got material %+v, want %+v", name, i, *gm, *wm)
+			}
+			if !equalFloats(gg.Vertexes, wg.Vertexes) || !equalFloats(gg.Normals, wg.Normals) {
+				t.Errorf("object %q group %d: faces differ\ngot  %v / %v\nwant %v / %v", name, i,
+					gg.Vertexes, gg.Normals, wg.Vertexes, wg.Normals)
+			}
+			if !equalFloats(gg.Lines, wg.Lines) {
+				t.Errorf("object %q group %d: got lines %v, want %v", name, i, gg.Lines, wg.Lines)
+			}
+		}
+	}
+
+	// shared vertexes are only written once: 8 box corners, 4 for the top and one more
+	// for the outline
+	if n := strings.Count(obj.String(), "\nv "); n != 13 {
+		t.Errorf("got %d vertexes, want 13", n)
+	}
+}
+
+func TestWriteSTL(t *testing.T) {
+	objects := testObjects()
+	// 12 triangles of the box, 2 of the top; lines aren't exported
+	const triangles = 14
+
+	var bin bytes.Buffer
+	if err := WriteSTL(&bin, "test", objects, false); err != nil {
+		t.Fatal(err)
+	}
+	if bin.Len() != 84+50*triangles {
+		t.Errorf("binary STL has %d bytes, want %d", bin.Len(), 84+50*triangles)
+	}
+	if bin.Len() >= 84 {
+		if n := binary.LittleEndian.Uint32(bin.Bytes()[80:]); n != triangles {
+			t.Errorf("binary STL header says %d triangles, want %d", n, triangles)
+		}
+	}
+
+	var ascii bytes.Buffer
+	if err := WriteSTL(&ascii, "test", objects, true); err != nil {
+		t.Fatal(err)
+	}
+	s := ascii.String()
+	if !strings.HasPrefix(s, "solid test\n") || !strings.HasSuffix(s, "endsolid test\n") {
+		t.Errorf("ASCII STL is not a solid named test:\n%s", s)
+	}
+	if n := strings.Count(s, "facet normal"); n != triangles {
+		t.Errorf("ASCII STL has %d facets, want %d", n, triangles)
+	}
+	if n := strings.Count(s, "vertex "); n != 3*triangles {
+		t.Errorf("ASCII STL has %d vertexes, want %d", n, 3*triangles)
+	}
+}
+
+func TestWriteOBJMissingNormals(t *testing.T) {
+	// the second triangle has a normal for its first vertex only
+	g := &Group{Material: newMaterial(""),
+		Vertexes: []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 0, 1, 1, 0, 1, 1, 1, 1},
+		Normals:  []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1},
+	}
+	var obj bytes.Buffer
+	if err := WriteOBJ(&obj, "test.mtl", map[string]*Object{"o": {Name: "o", Groups: []*Group{g}}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(obj.String(), "\nf 1//1 2//1 3//1\n") || !strings.Contains(obj.String(), "\nf 4 5 6\n") {
+		t.Errorf("faces not written as expected:\n%s", obj.String())
+	}
+}
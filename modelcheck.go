@@ -0,0 +1,264 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tolerances used when checking models
+const (
+	degenerateArea   = 1e-9
+	normalTolerance  = 1e-3
+	maxReportedFaces = 5
+)
+
+// modelReport holds the statistics and problems found when checking a model file
+type modelReport struct {
+	fileName string
+
+	objects int
+	groups  int
+	faces   int
+
+	// vertices holds the distinct vertex positions used by the faces; the parser
+	// resolves the vertex indexes, so faces sharing a vertex refer to the same position
+	vertices map[[3]float32]bool
+
+	min [3]float32
+	max [3]float32
+
+	problems []string
+}
+
+// checkModel loads a model file and examines its geometry
+func checkModel(fileName string) *modelReport {
+	r := &modelReport{fileName: fileName, vertices: make(map[[3]float32]bool)}
+
+	objects, err := Read(fileName)
+	if err != nil {
+		r.problems = append(r.problems, err.Error())
+		return r
+	}
+	if len(objects) == 0 {
+		r.problems = append(r.problems, "no objects defined")
+		return r
+	}
+
+	for i := 0; i < 3; i++ {
+		r.min[i] = math.MaxFloat32
+		r.max[i] = -math.MaxFloat32
+	}
+
+	// sort object names so the report is stable
+	var names []string
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		obj := objects[name]
+		r.objects++
+		if len(obj.Groups) == 0 {
+			r.problems = append(r.problems, fmt.Sprintf("object %q has no faces", name))
+		}
+		for gi, group := range obj.Groups {
+			r.groups++
+			r.checkGroup(name, gi, group)
+		}
+	}
+	return r
+}
+
+// checkGroup examines the faces of a group and adds them to the statistics
+func (r *modelReport) checkGroup(objName string, gi int, group *Group) {
+	if group.Material == nil || group.Material.Name == "" {
+		r.problems = append(r.problems, fmt.Sprintf("object %q group %d has no material", objName, gi))
+	}
+	if len(group.Vertexes) != len(group.Normals) {
+		r.problems = append(r.problems, fmt.Sprintf("object %q group %d has %d vertex coordinates but %d normal coordinates",
+			objName, gi, len(group.Vertexes), len(group.Normals)))
+		return
+	}
+
+	v := group.Vertexes
+	degenerate, badNormals := 0, 0
+	for f := 0; f+9 <= len(v); f += 9 {
+		r.faces++
+		for c := 0; c < 9; c += 3 {
+			r.vertices[[3]float32{v[f+c], v[f+c+1], v[f+c+2]}] = true
+			for i := 0; i < 3; i++ {
+				if v[f+c+i] < r.min[i] {
+					r.min[i] = v[f+c+i]
+				}
+				if v[f+c+i] > r.max[i] {
+					r.max[i] = v[f+c+i]
+				}
+			}
+			n := group.Normals[f+c : f+c+3]
+			l := math.Sqrt(float64(n[0]*n[0] + n[1]*n[1] + n[2]*n[2]))
+			if math.Abs(l-1) > normalTolerance {
+				if badNormals < maxReportedFaces {
+					r.problems = append(r.problems, fmt.Sprintf("object %q group %d face %d: normal (%g, %g, %g) has length %.4f",
+						objName, gi, f/9, n[0], n[1], n[2], l))
+				}
+				badNormals++
+			}
+		}
+
+		// area of the triangle is half the length of the cross product of two edges
+		e1 := [3]float64{float64(v[f+3] - v[f]), float64(v[f+4] - v[f+1]), float64(v[f+5] - v[f+2])}
+		e2 := [3]float64{float64(v[f+6] - v[f]), float64(v[f+7] - v[f+1]), float64(v[f+8] - v[f+2])}
+		cx := e1[1]*e2[2] - e1[2]*e2[1]
+		cy := e1[2]*e2[0] - e1[0]*e2[2]
+		cz := e1[0]*e2[1] - e1[1]*e2[0]
+		if math.Sqrt(cx*cx+cy*cy+cz*cz)/2 < degenerateArea {
+			if degenerate < maxReportedFaces {
+				r.problems = append(r.problems, fmt.Sprintf("object %q group %d face %d is degenerate", objName, gi, f/9))
+			}
+			degenerate++
+		}
+	}
+	if degenerate > maxReportedFaces {
+		r.problems = append(r.problems, fmt.Sprintf("object %q group %d: %d more degenerate faces",
+			objName, gi, degenerate-maxReportedFaces))
+	}
+	if badNormals > maxReportedFaces {
+		r.problems = append(r.problems, fmt.Sprintf("object %q group %d: %d more non-unit normals",
+			objName, gi, badNormals-maxReportedFaces))
+	}
+}
+
+// print writes the report to w
+func (r *modelReport) print(w io.Writer) {
+	fmt.Fprintf(w, "%s: ", r.fileName)
+	if r.faces > 0 {
+		fmt.Fprintf(w, "%d objects, %d groups, %d faces, %d vertices, bounds (%.3f, %.3f, %.3f)-(%.3f, %.3f, %.3f)",
+			r.objects, r.groups, r.faces, len(r.vertices),
+			r.min[0], r.min[1], r.min[2], r.max[0], r.max[1], r.max[2])
+	}
+	if len(r.problems) == 0 {
+		fmt.Fprintln(w, " OK")
+		return
+	}
+	fmt.Fprintf(w, " %d problems\n", len(r.problems))
+	for _, p := range r.problems {
+		fmt.Fprintf(w, "    %s\n", p)
+	}
+}
+
+// modelsCommand handles the "gofusion models" subcommands
+func modelsCommand(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "check":
+			return modelsCheckCommand(args[1:])
+		case "generate":
+			return modelsGenerateCommand(args[1:])
+		}
+	}
+	return fmt.Errorf("usage: gofusion models check [-assets dir] [-theme name] [file.obj ...]\n" +
+		"       gofusion models generate [-o dir] value ...")
+}
+
+// modelsCheckCommand handles "gofusion models check [-assets dir] [-theme name] [file.obj ...]",
+// which checks the given model files, or the tile models of all themes (or the given
+// theme) if no files are given. Themes with models of their own need one for every tile
+// value. It fails if any problems are found.
+func modelsCheckCommand(args []string) error {
+	fs := flag.NewFlagSet("models check", flag.ExitOnError)
+	assetDir := fs.String("assets", "", "directory with assets overriding the built-in ones")
+	themeName := fs.String("theme", "", "only check the models of this theme")
+	fs.Parse(args)
+
+	files := fs.Args()
+	// reports for model files which are missing
+	var missing []*modelReport
+	if len(files) == 0 {
+		a := openAssets(*assetDir)
+		ts, err := loadThemes(a)
+		if err != nil {
+			return err
+		}
+		found := false
+		seen := make(map[string]bool)
+		for _, t := range ts {
+			if *themeName != "" && !strings.EqualFold(t.Name, *themeName) {
+				continue
+			}
+			found = true
+			for i := 1; i <= maxTileValue; i++ {
+				path, err := t.modelPath(a, i)
+				if err != nil {
+					return err
+				}
+				// missing built-in models are generated, but a theme with models of its
+				// own should have all of them; themes without share the built-in ones
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					if t.Models != "" {
+						missing = append(missing, &modelReport{fileName: path,
+							problems: []string{fmt.Sprintf("model of tile %d of theme %q not found", 1<<uint(i), t.Name)}})
+					}
+					continue
+				}
+				if !seen[path] {
+					files = append(files, path)
+					seen[path] = true
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("theme %q not found", *themeName)
+		}
+		if len(files) == 0 && len(missing) == 0 {
+			return fmt.Errorf("no model files found")
+		}
+	}
+
+	failed := len(missing)
+	for _, r := range missing {
+		r.print(os.Stdout)
+	}
+	for _, f := range files {
+		r := checkModel(f)
+		r.print(os.Stdout)
+		if len(r.problems) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d models have problems", failed, len(files)+len(missing))
+	}
+	return nil
+}
+
+// modelsGenerateCommand handles "gofusion models generate [-o dir] value ...", which writes
+// generated tile models for the given tile values as "tile_<value>.obj" (and ".mtl") to dir
+func modelsGenerateCommand(args []string) error {
+	fs := flag.NewFlagSet("models generate", flag.ExitOnError)
+	dir := fs.String("o", ".", "output directory")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no tile values given")
+	}
+	for _, arg := range fs.Args() {
+		v, err := strconv.Atoi(arg)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid tile value %q", arg)
+		}
+		fileName := filepath.Join(*dir, fmt.Sprintf("tile_%04d.obj", v))
+		if err := Write(fileName, generateTileModel(v)); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s written\n", fileName)
+	}
+	return nil
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/qml.v1"
+)
+
+// defaultServerPort is the port of the match server, unless set otherwise
+const defaultServerPort = "7048"
+
+// netWriteTimeout is the time a peer gets to take a message, before the connection is given up
+const netWriteTimeout = 10 * time.Second
+
+// netMessage is a message between the match server and a client, sent as one line of JSON.
+//
+//	server to client: "wait" (no opponent yet), "start" (Seed, Target and Attack mode of the
+//	                  game), "move" (Move and Score of the opponent), "attack" (Stones sent
+//	                  by the opponent), "over" (Result: "win", "lose" or "draw"), "left" (the
+//	                  opponent is gone)
+//	client to server: "move" (Move and Score; S for each stone received)
+//
+// The server doesn't trust the clients: it replays the moves of both players from the seed,
+// so it knows the stones sent by each move and who has won. A move which the board doesn't
+// allow, or whose score differs from the one the server has got, loses the match.
+type netMessage struct {
+	Type   string
+	Seed   int64  `json:",omitempty"`
+	Target int    `json:",omitempty"`
+	Attack bool   `json:",omitempty"`
+	Stones int    `json:",omitempty"`
+	Move   string `json:",omitempty"`
+	Score  int    `json:",omitempty"`
+	Result string `json:",omitempty"`
+}
+
+// netConn is a connection between the match server and a client
+type netConn struct {
+	conn net.Conn
+	dec  *json.Decoder
+
+	mu  sync.Mutex // serializes sending
+	enc *json.Encoder
+}
+
+func newNetConn(c net.Conn) *netConn {
+	return &netConn{conn: c, dec: json.NewDecoder(c), enc: json.NewEncoder(c)}
+}
+
+// send sends a message (json.Encoder ends it with a line break). It fails if the peer doesn't
+// take the message within netWriteTimeout.
+func (c *netConn) send(m netMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(netWriteTimeout))
+	return c.enc.Encode(m)
+}
+
+// receive waits for the next message
+func (c *netConn) receive() (netMessage, error) {
+	var m netMessage
+	err := c.dec.Decode(&m)
+	return m, err
+}
+
+func (c *netConn) close() {
+	c.conn.Close()
+}
+
+// ### MATCH SERVER ###
+
+// matchServer pairs the clients connecting to it, two at a time, and relays the moves between
+// the two players of each match
+type matchServer struct {
+	target int  // tile value which wins
+	attack bool // play attack games
+
+	mu      sync.Mutex
+	waiting *netConn // client waiting for an opponent
+}
+
+// match is a game of two clients on the match server. The server decides who has won, on its
+// own copy of the game: the first player to reach the target tile, or the higher score once
+// both players are stuck.
+type match struct {
+	mu      sync.Mutex
+	game    *versusGame
+	players [2]matchPlayer
+	over    bool
+}
+
+type matchPlayer struct {
+	c      *netConn
+	stones int // stones sent to the player which it hasn't reported as dropped yet
+}
+
+// delivery is a message for a player, which is sent once the match is unlocked, so a slow
+// player doesn't hold up the other one
+type delivery struct {
+	to  *netConn
+	msg netMessage
+}
+
+// deliver sends the messages; connections which fail are closed, which ends their relay
+func deliver(out []delivery) {
+	for _, d := range out {
+		if err := d.to.send(d.msg); err != nil {
+			d.to.close()
+		}
+	}
+}
+
+// serveCommand handles "gofusion serve [-addr address] [-target value] [-attack]", which runs
+// the match server for online games
+func serveCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":"+defaultServerPort, "address to listen on")
+	target := fs.Int("target", defaultVersusTarget, "tile value which wins a match")
+	attack := fs.Bool("attack", false, "play attack games, in which big merges drop stones on the opponent's board")
+	fs.Parse(args)
+	if tileLevel(*target) < 1 {
+		return fmt.Errorf("invalid target tile %d", *target)
+	}
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "match server listening on %s\n", l.Addr())
+	s := &matchServer{target: *target, attack: *attack}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.join(newNetConn(conn))
+	}
+}
+
+// join lets a client wait for an opponent, or starts a match with the client already waiting
+func (s *matchServer) join(c *netConn) {
+	s.mu.Lock()
+	opponent := s.waiting
+	if opponent == nil {
+		s.waiting = c
+	} else {
+		s.waiting = nil
+	}
+	s.mu.Unlock()
+	if opponent == nil {
+		deliver([]delivery{{c, netMessage{Type: "wait"}}})
+		return
+	}
+
+	seed := time.Now().UnixNano()
+	start := netMessage{Type: "start", Seed: seed, Target: s.target, Attack: s.attack}
+	if err := opponent.send(start); err != nil {
+		// the waiting client is gone, the new one waits instead
+		opponent.close()
+		s.join(c)
+		return
+	}
+	// if the new client is gone, the match ends right away, as the opponent has left
+	deliver([]delivery{{c, start}})
+
+	m := &match{game: newVersusGame(seed, s.target), players: [2]matchPlayer{{c: opponent}, {c: c}}}
+	m.game.online = true
+	m.game.attack = s.attack
+	fmt.Fprintf(os.Stderr, "match started: %s against %s\n", opponent.conn.RemoteAddr(), c.conn.RemoteAddr())
+	for i := range m.players {
+		go m.relay(i)
+	}
+}
+
+// relay handles the messages of one player of the match until the player disconnects
+func (m *match) relay(i int) {
+	p, other := &m.players[i], &m.players[1-i]
+	for {
+		msg, err := p.c.receive()
+		var out []delivery
+		m.mu.Lock()
+		if err != nil {
+			if !m.over {
+				m.over = true
+				out = append(out, delivery{other.c, netMessage{Type: "left"}})
+			}
+			m.mu.Unlock()
+			deliver(out)
+			p.c.close()
+			other.c.close()
+			return
+		}
+		if msg.Type == "move" {
+			out = m.move(i, msg)
+		}
+		m.mu.Unlock()
+		deliver(out)
+	}
+}
+
+// move replays a move of player i on the server's copy of the game, and returns the messages
+// telling the opponent about it (and the result, if the move ends the match). A move which
+// doesn't fit the board loses the match.
+func (m *match) move(i int, msg netMessage) []delivery {
+	if m.over {
+		return nil
+	}
+	p, other := &m.players[i], &m.players[1-i]
+	b := m.game.boards[i]
+	valid := len(msg.Move) == 1
+	if valid && msg.Move[0] == stoneDrop {
+		valid = p.stones > 0
+		p.stones--
+	}
+	n := len(b.moves)
+	stones := 0
+	if valid {
+		stones = m.game.move(i, msg.Move[0])
+		valid = len(b.moves) > n && b.score == msg.Score
+	}
+	if !valid {
+		fmt.Fprintf(os.Stderr, "match: %s sent move %q with score %d, which doesn't fit its board\n",
+			p.c.conn.RemoteAddr(), msg.Move, msg.Score)
+		return m.end(1 - i)
+	}
+
+	out := []delivery{{other.c, netMessage{Type: "move", Move: msg.Move, Score: b.score}}}
+	if stones > 0 {
+		other.stones += stones
+		out = append(out, delivery{other.c, netMessage{Type: "attack", Stones: stones}})
+	}
+	m.game.checkEnd()
+	switch m.game.winner {
+	case 0, 1:
+		out = append(out, m.end(m.game.winner)...)
+	case 2:
+		out = append(out, m.end(-1)...)
+	}
+	return out
+}
+
+// end returns the messages telling both players the result of the match: the winner, or a draw
+// if winner is -1
+func (m *match) end(winner int) []delivery {
+	if m.over {
+		return nil
+	}
+	m.over = true
+	var out []delivery
+	for i := range m.players {
+		result := "lose"
+		switch winner {
+		case i:
+			result = "win"
+		case -1:
+			result = "draw"
+		}
+		out = append(out, delivery{m.players[i].c, netMessage{Type: "over", Result: result}})
+	}
+	return out
+}
+
+// ### ONLINE MODE ###
+
+// HandleOnlineButton connects to the match server for a game against another player
+func (ctrl *Control) HandleOnlineButton() {
+	ctrl.LevelScreen.Set("visible", false)
+	ctrl.saveLastGame()
+	ctrl.clearQueue()
+	ctrl.paused = false
+	if ctrl.editing {
+		ctrl.setEditing(false)
+	}
+	ctrl.startOnline()
+}
+
+// startOnline connects to the match server and waits for an opponent. The game is shown on the
+// versus screen, with the opponent's board on the right.
+func (ctrl *Control) startOnline() {
+	ctrl.stopOnline()
+	ctrl.versus = nil
+	addr := server
+	if addr == "" && ctrl.settings != nil {
+		addr = ctrl.settings.GetServer()
+	}
+	if addr == "" {
+		addr = "localhost:" + defaultServerPort
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		ctrl.VersusScreen.Set("visible", false)
+		ctrl.SetMessage("Cannot connect", err.Error())
+		return
+	}
+	ctrl.VersusScreen.Set("online", true)
+	ctrl.VersusScreen.Set("visible", true)
+	c := newNetConn(conn)
+	ctrl.online = c
+	ctrl.VersusScreen.Set("message", "Connecting")
+	ctrl.VersusScreen.Set("submessage", addr)
+	go func() {
+		for {
+			m, err := c.receive()
+			if err != nil {
+				m = netMessage{Type: "left"}
+			}
+			qml.RunMain(func() { ctrl.handleNetMessage(c, m) })
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// stopOnline closes the connection to the match server, if any
+func (ctrl *Control) stopOnline() {
+	if ctrl.online != nil {
+		ctrl.online.close()
+		ctrl.online = nil
+	}
+	ctrl.VersusScreen.Set("online", false)
+}
+
+// handleNetMessage handles a message from the match server
+func (ctrl *Control) handleNetMessage(c *netConn, m netMessage) {
+	if c != ctrl.online {
+		// from a connection closed in the meantime
+		return
+	}
+	g := ctrl.versus
+	switch m.Type {
+	case "wait":
+		ctrl.VersusScreen.Set("message", "Waiting for an opponent")
+	case "start":
+		ctrl.versus = newVersusGame(m.Seed, m.Target)
+		ctrl.versus.online = true
+		ctrl.versus.attack = m.Attack
+		ctrl.VersusScreen.Set("message", "First to "+strconv.Itoa(m.Target)+" wins")
+		ctrl.VersusScreen.Set("submessage", "your opponent is on the right")
+		ctrl.updateVersus()
+	case "move":
+		if g == nil || len(m.Move) != 1 {
+			return
+		}
+		if _, _, ok := g.boards[1].topology().step(m.Move[0]); ok || m.Move[0] == stoneDrop {
+			g.move(1, m.Move[0])
+			ctrl.updateVersus()
+		}
+	case "attack":
+		// the stones are reported back as moves, so they land on the same fields of the
+		// opponent's copy of this board
+		if g == nil || !g.attack {
+			return
+		}
+		b := g.boards[0]
+		for i := 0; i < m.Stones; i++ {
+			n := len(b.moves)
+			g.move(0, stoneDrop)
+			if len(b.moves) > n {
+				ctrl.sendMove(b, stoneDrop)
+			}
+		}
+		ctrl.updateVersus()
+	case "over":
+		if g == nil {
+			return
+		}
+		switch m.Result {
+		case "win":
+			g.winner = 0
+			ctrl.VersusScreen.Set("message", "You win!")
+		case "lose":
+			g.winner = 1
+			ctrl.VersusScreen.Set("message", "You lose")
+		default:
+			g.winner = 2
+			ctrl.VersusScreen.Set("message", "It's a draw!")
+		}
+		ctrl.VersusScreen.Set("submessage", "click 'Restart' for another match")
+	case "left":
+		if g != nil && g.winner < 0 {
+			g.winner = 0
+			ctrl.VersusScreen.Set("message", "Your opponent has left")
+		} else if g == nil {
+			ctrl.VersusScreen.Set("message", "Connection closed")
+		}
+		ctrl.VersusScreen.Set("submessage", "click 'Restart' for another match")
+	}
+}
+
+// sendMove reports a move of the player to the match server, which works out the stones it
+// sends to the opponent and whether it ends the match
+func (ctrl *Control) sendMove(b *Board, dir byte) {
+	ctrl.online.send(netMessage{Type: "move", Move: string(dir), Score: b.score})
+}
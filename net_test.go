@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+// testMatch returns a match on the server, as started by join, with connections which are
+// never read from
+func testMatch(seed int64) *match {
+	var players [2]matchPlayer
+	for i := range players {
+		c, _ := net.Pipe()
+		players[i].c = newNetConn(c)
+	}
+	m := &match{game: newVersusGame(seed, defaultVersusTarget), players: players}
+	m.game.online = true
+	return m
+}
+
+func TestMatchMoves(t *testing.T) {
+	const seed = 42
+	// find a move of the first player which changes the board, and the score it gives
+	ref := newVersusGame(seed, defaultVersusTarget)
+	var dir byte
+	for _, d := range []byte("LRUD") {
+		ref.move(0, d)
+		if len(ref.boards[0].moves) > 0 {
+			dir = d
+			break
+		}
+	}
+	if dir == 0 {
+		t.Fatal("no move possible on the start board")
+	}
+	score := ref.boards[0].score
+
+	type message struct {
+		to     int
+		typ    string
+		result string
+	}
+	tests := []struct {
+		name   string
+		stones int // stones sent to the first player before the move
+		move   string
+		score  int
+		want   []message
+	}{
+		{"valid move", 0, string(dir), score, []message{{1, "move", ""}}},
+		{"wrong score", 0, string(dir), score + 4, []message{{0, "over", "lose"}, {1, "over", "win"}}},
+		{"stone", 1, "S", 0, []message{{1, "move", ""}}},
+		{"stone without stones", 0, "S", 0, []message{{0, "over", "lose"}, {1, "over", "win"}}},
+		{"no move", 0, "", score, []message{{0, "over", "lose"}, {1, "over", "win"}}},
+	}
+	for _, tt := range tests {
+		m := testMatch(seed)
+		m.players[0].stones = tt.stones
+		out := m.move(0, netMessage{Type: "move", Move: tt.move, Score: tt.score})
+		if len(out) != len(tt.want) {
+			t.Errorf("%s: got %d messages, want %d: %+v", tt.name, len(out), len(tt.want), out)
+			continue
+		}
+		for i, w := range tt.want {
+			d := out[i]
+			if d.to != m.players[w.to].c || d.msg.Type != w.typ || d.msg.Result != w.result {
+				t.Errorf("%s: message %d is %+v, want %q %q to player %d", tt.name, i, d.msg, w.typ, w.result, w.to)
+			}
+		}
+		if over := len(tt.want) > 0 && tt.want[0].typ == "over"; m.over != over {
+			t.Errorf("%s: match over is %v, want %v", tt.name, m.over, over)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math"
+	"strings"
+
+	"gopkg.in/qml.v1"
+)
+
+// maxEmitters limits the number of particle emitters running at the same time, so chains
+// of merges don't bring down the frame rate
+const maxEmitters = 40
+
+// effectsIntensity maps the values of the Effects setting to a factor for the number of emitters
+var effectsIntensity = map[string]float64{
+	"":       1,
+	"high":   1,
+	"medium": 0.6,
+	"low":    0.3,
+	"off":    0,
+}
+
+// ParticlePreset describes the particle effect shown when tiles merge. Emitters fly from the
+// merged tile to random targets, leaving a trail of sparks; higher tile values get more, and
+// longer living, emitters.
+type ParticlePreset struct {
+	// color of the sparks per tile value (2, 4, 8, ...), e.g. "#ffcc00"; values without
+	// a color get sparks of random colors
+	Colors map[int]string
+	// how the emitters are spread: "burst" (random targets around the tile), "ring" (evenly
+	// spread in a circle) or "fountain" (upwards)
+	Shape string
+	// distance in pixels the emitters fly (for grid cells of referenceGrid pixels; it is
+	// scaled with the size of the board)
+	Spread int
+	// downward acceleration of the sparks in pixels/s²
+	Gravity float64
+	// number of emitters per tile level (the level of a 2 is 1, of a 4 is 2 etc.)
+	Count float64
+	// life time of the emitters in milliseconds, plus a random part of up to LifePerLevel
+	// per tile level
+	Life         int
+	LifePerLevel int
+}
+
+// setDefaults fills in the defaults for everything left out in the theme
+func (p *ParticlePreset) setDefaults() {
+	if p.Shape == "" {
+		p.Shape = "burst"
+	}
+	if p.Spread <= 0 {
+		p.Spread = 120
+	}
+	if p.Count <= 0 {
+		p.Count = 2
+	}
+	if p.Life <= 0 {
+		p.Life = 400
+	}
+	if p.LifePerLevel <= 0 {
+		p.LifePerLevel = 200
+	}
+}
+
+// fieldCenter returns the position of the center of field x, y of the board in the game canvas,
+// as the field is shown in the perspective of the board view
+func (ctrl *Control) fieldCenter(x, y int) (int, int) {
+	width, height := float32(ctrl.BoardView.Int("width")), float32(ctrl.BoardView.Int("height"))
+	if width <= 0 || height <= 0 {
+		return ctrl.layout.center(x, y)
+	}
+	topo := board.topology()
+	bw, bh := topo.extent()
+	sc := newScene(currentTheme, ctrl.camera, nil, bw, bh, width/height)
+	cx, cy := topo.pos(x, y)
+	px, py := sc.project(cx+0.5, cy+0.5, width, height)
+	return ctrl.BoardView.Int("x") + int(px), ctrl.BoardView.Int("y") + int(py)
+}
+
+// Emit shows a particle ("spark") animation at position x, y
+// higher level values increase the intensity of the effect
+func (ctrl *Control) Emit(x, y, level int) {
+	intensity := ctrl.effects
+	if intensity == 0 {
+		return
+	}
+	p := currentTheme.Particles
+	count := int(math.Round(p.Count*float64(level)*intensity)) + 1
+	if free := maxEmitters - ctrl.emitters; count > free {
+		count = free
+	}
+
+	spread := float64(p.Spread) * ctrl.layout.scale()
+	group := ctrl.particleGroup(p.Colors[1<<uint(level)])
+	component := ctrl.Root.Object("emitterComponent")
+	for i := 0; i < count; i++ {
+		var dx, dy float64
+		switch p.Shape {
+		case "ring":
+			a := 2 * math.Pi * (float64(i) + randGen.Float64()*0.3) / float64(count)
+			dx, dy = math.Cos(a)*spread, math.Sin(a)*spread
+		case "fountain":
+			dx = (randGen.Float64() - 0.5) * spread
+			dy = -(0.5 + randGen.Float64()) * spread
+		default:
+			dx = (randGen.Float64()*2 - 1) * spread
+			dy = (randGen.Float64()*2 - 1) * spread
+		}
+
+		emitter := component.Create(nil)
+		emitter.Set("group", group)
+		emitter.Set("x", x)
+		emitter.Set("y", y)
+		emitter.Set("targetX", x+int(dx))
+		emitter.Set("targetY", y+int(dy))
+		emitter.Set("life", randGen.Intn(p.LifePerLevel*level+1)+p.Life)
+		emitter.Set("emitRate", randGen.Intn(5*level+1)+20)
+		emitter.ObjectByName("xAnim").Call("start")
+		emitter.ObjectByName("yAnim").Call("start")
+		emitter.Set("enabled", true)
+		ctrl.emitters++
+	}
+}
+
+// particleGroup returns the name of the particle group showing sparks of the given color
+// ("" for the default group with random colors), creating it if necessary
+func (ctrl *Control) particleGroup(color string) string {
+	if color == "" {
+		return ""
+	}
+	name := "c" + strings.TrimPrefix(strings.ToLower(color), "#")
+	if ctrl.particleGroups == nil {
+		ctrl.particleGroups = make(map[string]qml.Object)
+	}
+	if _, ok := ctrl.particleGroups[name]; !ok {
+		painter := ctrl.Root.Object("particlePainterComponent").Create(nil)
+		painter.Set("parent", ctrl.Root)
+		painter.Set("groups", []string{name})
+		painter.Set("color", color)
+		ctrl.particleGroups[name] = painter
+	}
+	return name
+}
+
+// applyParticles passes the particle settings of the current theme to the QML side
+func (ctrl *Control) applyParticles() {
+	ctrl.Root.Set("particleGravity", currentTheme.Particles.Gravity)
+	for name, painter := range ctrl.particleGroups {
+		painter.Destroy()
+		delete(ctrl.particleGroups, name)
+	}
+}
+
+// Done handles the timeout event which ends the particle animation
+func (ctrl *Control) Done(emitter qml.Object) {
+	emitter.Destroy()
+	if ctrl.emitters > 0 {
+		ctrl.emitters--
+	}
+}
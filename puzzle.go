@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Spawn is a tile added to the board after a move in a puzzle. If the field is taken, the tile
+// goes to the next free field (in reading order).
+type Spawn struct {
+	X, Y  int
+	Value int // 2, 4, 8, ...
+}
+
+// PuzzleGoal describes what has to be achieved to solve a puzzle level. All the conditions
+// which are set have to be met at the same time.
+type PuzzleGoal struct {
+	Tile     int // reach a tile of this value
+	MaxTiles int // clear the board down to at most this number of tiles
+	Score    int // reach this score
+	Moves    int // maximum number of moves (0: no limit)
+}
+
+// PuzzleLevel is a puzzle with a fixed start layout (see parseBoard) and fixed tiles added
+// after each move instead of random ones; when the spawn sequence is used up, no more tiles
+// are added
+type PuzzleLevel struct {
+	Name   string
+	Start  string
+	Spawns []Spawn
+	Goal   PuzzleGoal
+}
+
+// PuzzlePack is a set of levels, read from "puzzles/<id>.json" in the assets. The levels of a
+// pack are played in order: a level can be played once the one before it has been solved.
+type PuzzlePack struct {
+	Name   string
+	Levels []*PuzzleLevel
+
+	id string
+}
+
+// loadPuzzlePacks reads all puzzle packs from the assets, sorted by file name
+func loadPuzzlePacks(a *Assets) ([]*PuzzlePack, error) {
+	root, err := a.Root()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(root, "puzzles", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var packs []*PuzzlePack
+	for _, f := range files {
+		n, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		p := new(PuzzlePack)
+		if err := json.Unmarshal(n, p); err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		p.id = strings.TrimSuffix(filepath.Base(f), ".json")
+		if p.Name == "" {
+			p.Name = p.id
+		}
+		if err := p.check(); err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		packs = append(packs, p)
+	}
+	return packs, nil
+}
+
+// check makes sure all levels of the pack can be played
+func (p *PuzzlePack) check() error {
+	for i, l := range p.Levels {
+		_, w, h, err := parseBoard(l.Start)
+		if err == nil && (w != boardSize || h != boardSize) {
+			err = fmt.Errorf("start layout is %dx%d instead of %dx%d", w, h, boardSize, boardSize)
+		}
+		for _, s := range l.Spawns {
+			if err == nil && (s.X < 0 || s.X >= boardSize || s.Y < 0 || s.Y >= boardSize || tileLevel(s.Value) < 1) {
+				err = fmt.Errorf("invalid spawn %+v", s)
+			}
+		}
+		g := l.Goal
+		if err == nil && g.Tile == 0 && g.MaxTiles == 0 && g.Score == 0 {
+			err = fmt.Errorf("no goal")
+		}
+		if err == nil && g.Tile != 0 && tileLevel(g.Tile) < 1 {
+			err = fmt.Errorf("invalid goal tile %d", g.Tile)
+		}
+		if err != nil {
+			return fmt.Errorf("level %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// tileLevel returns the level of a tile value (1 for 2, 2 for 4 etc.), or 0 if v is not
+// a tile value
+func tileLevel(v int) int {
+	if v < 2 || v&(v-1) != 0 {
+		return 0
+	}
+	level := 0
+	for ; v > 1; v >>= 1 {
+		level++
+	}
+	return level
+}
+
+// String describes the goal, e.g. "reach 64 in 10 moves"
+func (g PuzzleGoal) String() string {
+	var parts []string
+	if g.Tile != 0 {
+		parts = append(parts, "reach "+strconv.Itoa(g.Tile))
+	}
+	if g.MaxTiles != 0 {
+		parts = append(parts, "clear the board to "+strconv.Itoa(g.MaxTiles)+" tiles")
+	}
+	if g.Score != 0 {
+		parts = append(parts, "score "+strconv.Itoa(g.Score))
+	}
+	s := strings.Join(parts, " and ")
+	if g.Moves != 0 {
+		s += " in " + strconv.Itoa(g.Moves) + " moves"
+	}
+	return s
+}
+
+// reached returns whether the board meets the goal
+func (g PuzzleGoal) reached(b *Board) bool {
+	tiles, best := 0, 0
+	for _, t := range b.tiles {
+		if t != nil {
+			tiles++
+			if t.Value() > best {
+				best = t.Value()
+			}
+		}
+	}
+	if g.Moves != 0 && len(b.moves) > g.Moves {
+		return false
+	}
+	return (g.Tile == 0 || best >= tileLevel(g.Tile)) &&
+		(g.MaxTiles == 0 || tiles <= g.MaxTiles) &&
+		(g.Score == 0 || b.score >= g.Score)
+}
+
+// failed returns whether the goal can no longer be reached: all moves used up, or no move possible
+func (g PuzzleGoal) failed(b *Board) bool {
+	if g.Moves != 0 && len(b.moves) >= g.Moves {
+		return true
+	}
+	_, ok := b.bestMove()
+	return !ok
+}
+
+// spawnTile adds a tile after a move: the next one of the spawn sequence in puzzles,
+// a random one otherwise
+func (b *Board) spawnTile() {
+	switch {
+	case b.puzzle:
+		if b.nextSpawn >= len(b.spawns) {
+			return
+		}
+		s := b.spawns[b.nextSpawn]
+		b.nextSpawn++
+		b.addTileNear(s.X, s.Y, tileLevel(s.Value))
+	case b.shared:
+		// always take the same numbers from the generator, whatever the board looks like
+		v := b.rand.Intn(2) + 1
+		x, y := b.rand.Intn(b.width), b.rand.Intn(b.height)
+		b.addTileNear(x, y, v)
+	case b.specials:
+		b.addRandomSpecialTile()
+	default:
+		b.addRandomTile()
+	}
+}
+
+// addTileNear adds a tile at the given position or, if the field is taken, at the next free
+// field (in reading order)
+func (b *Board) addTileNear(x, y, v int) {
+	for i := 0; !b.free(x, y); i++ {
+		if i == b.width*b.height {
+			return
+		}
+		if x++; x == b.width {
+			x, y = 0, (y+1)%b.height
+		}
+	}
+	b.addTileAt(x, y, v)
+}
+
+// newPuzzle starts a game of the puzzle level
+func (b *Board) newPuzzle(l *PuzzleLevel) error {
+	b.rule = ""
+	b.setHex(false)
+	if err := b.newGameFrom(0, l.Start); err != nil {
+		return err
+	}
+	b.puzzle = true
+	b.spawns = l.Spawns
+	return nil
+}
+
+// ### PUZZLE MODE ###
+
+// puzzleKey identifies a level in the progress stored in the settings
+func puzzleKey(p *PuzzlePack, level int) string {
+	return p.id + "/" + strconv.Itoa(level+1)
+}
+
+// puzzleEntry is a level as listed on the level select screen
+type puzzleEntry struct {
+	pack  *PuzzlePack
+	level int
+}
+
+// puzzleEntries returns all levels of all packs, in the order they are listed
+func (ctrl *Control) puzzleEntries() []puzzleEntry {
+	var entries []puzzleEntry
+	for _, p := range ctrl.puzzlePacks {
+		for i := range p.Levels {
+			entries = append(entries, puzzleEntry{p, i})
+		}
+	}
+	return entries
+}
+
+// solvedIn returns the fewest moves a level has been solved in by the current profile (0: not solved)
+func (ctrl *Control) solvedIn(e puzzleEntry) int {
+	if ctrl.settings == nil {
+		return 0
+	}
+	return ctrl.settings.GetPuzzleProgress()[puzzleKey(e.pack, e.level)]
+}
+
+// unlocked returns whether the level can be played
+func (ctrl *Control) unlocked(e puzzleEntry) bool {
+	return e.level == 0 || ctrl.solvedIn(puzzleEntry{e.pack, e.level - 1}) > 0
+}
+
+// HandlePuzzlesButton opens or closes the level select screen
+func (ctrl *Control) HandlePuzzlesButton() {
+	if ctrl.puzzlePacks == nil {
+		packs, err := loadPuzzlePacks(assets)
+		if err != nil {
+			ctrl.SetMessage("Cannot load puzzles", err.Error())
+			return
+		}
+		ctrl.puzzlePacks = packs
+	}
+	visible := !ctrl.LevelScreen.Bool("visible")
+	if visible {
+		list := ctrl.LevelScreen.ObjectByName("levelList")
+		list.Set("model", 0)
+		list.Set("model", len(ctrl.puzzleEntries()))
+	}
+	ctrl.LevelScreen.Set("visible", visible)
+}
+
+// LevelLabel returns the name of the i-th level on the level select screen
+func (ctrl *Control) LevelLabel(i int) string {
+	e := ctrl.puzzleEntries()[i]
+	l := e.pack.Levels[e.level]
+	return e.pack.Name + " " + strconv.Itoa(e.level+1) + ": " + l.Name
+}
+
+// LevelStatus returns the status of the i-th level on the level select screen
+func (ctrl *Control) LevelStatus(i int) string {
+	e := ctrl.puzzleEntries()[i]
+	if n := ctrl.solvedIn(e); n > 0 {
+		return "solved in " + strconv.Itoa(n) + " moves"
+	}
+	if !ctrl.unlocked(e) {
+		return "locked"
+	}
+	return e.pack.Levels[e.level].Goal.String()
+}
+
+// HandleLevelClicked starts the i-th level on the level select screen, if it is unlocked
+func (ctrl *Control) HandleLevelClicked(i int) {
+	e := ctrl.puzzleEntries()[i]
+	if !ctrl.unlocked(e) {
+		return
+	}
+	ctrl.LevelScreen.Set("visible", false)
+	ctrl.HandleVersusClose()
+	ctrl.startLevel(&e)
+}
+
+// startLevel starts a puzzle level
+func (ctrl *Control) startLevel(e *puzzleEntry) {
+	ctrl.saveLastGame()
+	ctrl.clearQueue()
+	ctrl.paused = false
+	if ctrl.editing {
+		ctrl.setEditing(false)
+	}
+	l := e.pack.Levels[e.level]
+	if err := board.newPuzzle(l); err != nil {
+		ctrl.SetMessage("Cannot start level", err.Error())
+		return
+	}
+	ctrl.level = e
+	ctrl.levelOver = false
+	ctrl.Running = false
+	ctrl.SetMessage(l.Name, l.Goal.String())
+	ctrl.showScore()
+}
+
+// checkPuzzle checks for the end of a puzzle after a move; it returns true if the level
+// has been solved or failed
+func (ctrl *Control) checkPuzzle() bool {
+	goal := ctrl.level.pack.Levels[ctrl.level.level].Goal
+	switch {
+	case goal.reached(&board):
+		n := len(board.moves)
+		if ctrl.settings != nil {
+			key := puzzleKey(ctrl.level.pack, ctrl.level.level)
+			if best := ctrl.settings.GetPuzzleProgress()[key]; best == 0 || n < best {
+				ctrl.settings.SetPuzzleProgress(key, n)
+			}
+		}
+		ctrl.SetMessage("Level solved!", "in "+strconv.Itoa(n)+" moves - click 'Modes' for the next one")
+		board.setBounceAnim()
+	case goal.failed(&board):
+		ctrl.SetMessage("Level failed", "click 'Restart' to try again")
+	default:
+		return false
+	}
+	ctrl.Running = false
+	ctrl.saveLastGame()
+	ctrl.clearQueue()
+	return true
+}
+
+// HandleClassicGame leaves the puzzle mode and starts a normal game
+func (ctrl *Control) HandleClassicGame() {
+	ctrl.LevelScreen.Set("visible", false)
+	ctrl.HandleVersusClose()
+	ctrl.level = nil
+	board.start = ""
+	board.specials = false
+	board.rule = ctrl.rule
+	board.setHex(false)
+	ctrl.HandleRestartButton()
+}
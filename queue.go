@@ -0,0 +1,62 @@
+package main
+
+// defaultQueueDepth is the number of moves buffered while the tiles are moving, unless set
+// otherwise in the settings
+const defaultQueueDepth = 4
+
+// queueAction executes a move or undo action, or buffers it if the tiles are still moving.
+// Buffered actions are executed in order once the board has settled, i.e. the tiles have been
+// merged and the new random tile has been added; actions beyond the queue depth are dropped.
+func (ctrl *Control) queueAction(action string) {
+	if board.moved || len(ctrl.queue) > 0 {
+		if len(ctrl.queue) < ctrl.queueDepth {
+			ctrl.queue = append(ctrl.queue, action)
+		}
+		return
+	}
+	ctrl.doAction(action)
+}
+
+// nextAction executes the next buffered action; it is called when the board has settled
+func (ctrl *Control) nextAction() {
+	if board.moved || len(ctrl.queue) == 0 {
+		return
+	}
+	action := ctrl.queue[0]
+	ctrl.queue = ctrl.queue[1:]
+	ctrl.doAction(action)
+}
+
+// clearQueue drops all buffered actions, e.g. when the game is over
+func (ctrl *Control) clearQueue() {
+	ctrl.queue = nil
+}
+
+// doAction executes a move or undo action on the settled board. When many actions are waiting,
+// the move is not animated (if the settings say so), so the board catches up quickly.
+func (ctrl *Control) doAction(action string) {
+	if action == "undo" {
+		// the daily challenge has one attempt, moves can't be taken back
+		if ctrl.daily == "" && board.undo() {
+			ctrl.levelOver = false
+			ctrl.showScore()
+			ctrl.SetMessage("", "")
+		}
+		ctrl.nextAction()
+		return
+	}
+
+	skip := ctrl.skipAnimations > 0 && len(ctrl.queue)+1 >= ctrl.skipAnimations
+	ctrl.instant = skip
+	board.move(actionMoves[action])
+	ctrl.instant = false
+
+	switch {
+	case !board.moved:
+		// nothing to animate
+		ctrl.nextAction()
+	case skip:
+		// no animation will signal its end
+		ctrl.HandleMoveAnimationDone()
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// minimum distance of vertexes from the near plane (in clip coordinates)
+const nearClip = 1e-5
+
+// rasterizer is a pure-Go renderer for scenes, used where no OpenGL context is available
+// (screenshots, thumbnails, tests). It mimics the fixed-function pipeline used by BoardView:
+// per-vertex lighting with a single point light, smooth shading, depth test, alpha blending
+// and stencilled shadows.
+type rasterizer struct {
+	width, height int
+	color         []float32 // RGBA per pixel, 0..1
+	depth         []float32 // normalized device depth per pixel
+	shadowed      []bool    // pixels already darkened by a shadow (like the stencil buffer)
+}
+
+// rasterVertex is a vertex after transformation and lighting
+type rasterVertex struct {
+	clip  [4]float32
+	color [4]float32
+}
+
+// newRasterizer creates a rasterizer with the background filled with a vertical gradient
+func newRasterizer(width, height int, top, bottom [4]float32) *rasterizer {
+	r := &rasterizer{
+		width:    width,
+		height:   height,
+		color:    make([]float32, 4*width*height),
+		depth:    make([]float32, width*height),
+		shadowed: make([]bool, width*height),
+	}
+	for y := 0; y < height; y++ {
+		f := (float32(y) + 0.5) / float32(height)
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			for c := 0; c < 4; c++ {
+				r.color[4*i+c] = top[c]*(1-f) + bottom[c]*f
+			}
+			r.depth[i] = 1
+		}
+	}
+	return r
+}
+
+// drawScene draws the board base, the shadows and the tiles of the scene
+func (r *rasterizer) drawScene(sc *scene) {
+	light := sc.view.transformPoint([3]float32{sc.light[0], sc.light[1], sc.light[2]})
+
+	r.drawItem(sc, sc.base, light, true)
+
+	shadow := sc.proj.mul(sc.view).mul(sc.shadow)
+	var col [4]float32
+	copy(col[:], shadowColor)
+	for _, it := range sc.items {
+		mvp := shadow.mul(it.model)
+		vs := make([]rasterVertex, len(it.group.Vertexes)/3)
+		for i := range vs {
+			vs[i] = rasterVertex{clip: mvp.transform4(vertexAt(it.group.Vertexes, i)), color: col}
+		}
+		r.drawTriangles(vs, false, true)
+	}
+
+	for i, it := range sc.items {
+		// transparent tiles don't hide what's behind them
+		r.drawItem(sc, it, light, i < sc.transparent)
+	}
+}
+
+// drawItem lights and draws the triangles of an item
+func (r *rasterizer) drawItem(sc *scene, it *drawItem, light [3]float32, writeDepth bool) {
+	modelView := sc.view.mul(it.model)
+	mvp := sc.proj.mul(modelView)
+	vs := make([]rasterVertex, len(it.group.Vertexes)/3)
+	for i := range vs {
+		p := vertexAt(it.group.Vertexes, i)
+		eye := modelView.transformPoint(p)
+		n := modelView.transformNormal(vertexAt(it.group.Normals, i))
+		vs[i] = rasterVertex{clip: mvp.transform4(p), color: shade(it, eye, n, light)}
+	}
+	r.drawTriangles(vs, writeDepth, false)
+}
+
+// vertexAt returns the i-th 3-component vector of a vertex or normal array
+func vertexAt(a []float32, i int) [3]float32 {
+	return [3]float32{a[3*i], a[3*i+1], a[3*i+2]}
+}
+
+// transform4 applies m to the point p and returns the homogeneous result
+func (m mat4) transform4(p [3]float32) [4]float32 {
+	var r [4]float32
+	for row := 0; row < 4; row++ {
+		r[row] = m[row]*p[0] + m[4+row]*p[1] + m[8+row]*p[2] + m[12+row]
+	}
+	return r
+}
+
+// shade computes the color of a vertex at eye position p with normal n, lit by a point
+// light at eye position light (OpenGL lighting equation with a non-local viewer)
+func shade(it *drawItem, p, n, light [3]float32) [4]float32 {
+	l := normalize([3]float32{light[0] - p[0], light[1] - p[1], light[2] - p[2]})
+	diff := dot(n, l)
+	var spec float32
+	if diff > 0 {
+		h := normalize([3]float32{l[0], l[1], l[2] + 1})
+		if nh := dot(n, h); nh > 0 {
+			spec = float32(math.Pow(float64(nh), float64(it.shininess)))
+		}
+	} else {
+		diff = 0
+	}
+
+	var c [4]float32
+	for i := 0; i < 3; i++ {
+		c[i] = clamp(it.ambient[i]*globalAmbient + it.diffuse[i]*diff + it.specular[i]*it.light[i]*spec)
+	}
+	c[3] = clamp(it.diffuse[3])
+	return c
+}
+
+// dot returns the dot product of a and b
+func dot(a, b [3]float32) float32 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+// clamp limits v to 0..1
+func clamp(v float32) float32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// drawTriangles draws a list of triangles, clipping them at the near plane. If shadow is set,
+// every pixel is only blended once, like the stencil setup of BoardView does.
+func (r *rasterizer) drawTriangles(vs []rasterVertex, writeDepth, shadow bool) {
+	for i := 0; i+2 < len(vs); i += 3 {
+		poly := clipNear([]rasterVertex{vs[i], vs[i+1], vs[i+2]})
+		for j := 1; j+1 < len(poly); j++ {
+			r.fillTriangle(poly[0], poly[j], poly[j+1], writeDepth, shadow)
+		}
+	}
+}
+
+// clipNear clips a polygon at the near plane (z >= -w)
+func clipNear(poly []rasterVertex) []rasterVertex {
+	inside := func(v rasterVertex) float32 { return v.clip[2] + v.clip[3] - nearClip }
+	var out []rasterVertex
+	for i, a := range poly {
+		b := poly[(i+1)%len(poly)]
+		da, db := inside(a), inside(b)
+		if da >= 0 {
+			out = append(out, a)
+		}
+		if (da >= 0) != (db >= 0) {
+			t := da / (da - db)
+			var v rasterVertex
+			for k := 0; k < 4; k++ {
+				v.clip[k] = a.clip[k] + t*(b.clip[k]-a.clip[k])
+				v.color[k] = a.color[k] + t*(b.color[k]-a.color[k])
+			}
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// fillTriangle rasterizes one triangle with perspective-correct color interpolation
+func (r *rasterizer) fillTriangle(a, b, c rasterVertex, writeDepth, shadow bool) {
+	type screenVertex struct {
+		x, y, z, invW float32
+	}
+	project := func(v rasterVertex) screenVertex {
+		w := v.clip[3]
+		return screenVertex{
+			x:    (v.clip[0]/w + 1) / 2 * float32(r.width),
+			y:    (1 - v.clip[1]/w) / 2 * float32(r.height),
+			z:    (v.clip[2]/w + 1) / 2,
+			invW: 1 / w,
+		}
+	}
+	p0, p1, p2 := project(a), project(b), project(c)
+
+	area := (p1.x-p0.x)*(p2.y-p0.y) - (p1.y-p0.y)*(p2.x-p0.x)
+	if area == 0 || math.IsNaN(float64(area)) {
+		return
+	}
+
+	minX := int(math.Max(0, math.Floor(float64(min3(p0.x, p1.x, p2.x)))))
+	maxX := int(math.Min(float64(r.width-1), math.Ceil(float64(max3(p0.x, p1.x, p2.x)))))
+	minY := int(math.Max(0, math.Floor(float64(min3(p0.y, p1.y, p2.y)))))
+	maxY := int(math.Min(float64(r.height-1), math.Ceil(float64(max3(p0.y, p1.y, p2.y)))))
+
+	for y := minY; y <= maxY; y++ {
+		py := float32(y) + 0.5
+		for x := minX; x <= maxX; x++ {
+			px := float32(x) + 0.5
+			// barycentric coordinates, positive inside for either winding
+			w0 := ((p1.x-px)*(p2.y-py) - (p1.y-py)*(p2.x-px)) / area
+			w1 := ((p2.x-px)*(p0.y-py) - (p2.y-py)*(p0.x-px)) / area
+			w2 := 1 - w0 - w1
+			if w0 < 0 || w1 < 0 || w2 < 0 {
+				continue
+			}
+
+			i := y*r.width + x
+			z := w0*p0.z + w1*p1.z + w2*p2.z
+			if z < 0 || z >= r.depth[i] || shadow && r.shadowed[i] {
+				continue
+			}
+
+			// interpolate the colors divided by w, then divide by the interpolated 1/w
+			q0, q1, q2 := w0*p0.invW, w1*p1.invW, w2*p2.invW
+			s := q0 + q1 + q2
+			var col [4]float32
+			for k := 0; k < 4; k++ {
+				col[k] = (q0*a.color[k] + q1*b.color[k] + q2*c.color[k]) / s
+			}
+
+			alpha := col[3]
+			for k := 0; k < 3; k++ {
+				r.color[4*i+k] = col[k]*alpha + r.color[4*i+k]*(1-alpha)
+			}
+			r.color[4*i+3] = alpha + r.color[4*i+3]*(1-alpha)
+			if writeDepth {
+				r.depth[i] = z
+			}
+			if shadow {
+				r.shadowed[i] = true
+			}
+		}
+	}
+}
+
+func min3(a, b, c float32) float32 {
+	return float32(math.Min(float64(a), math.Min(float64(b), float64(c))))
+}
+
+func max3(a, b, c float32) float32 {
+	return float32(math.Max(float64(a), math.Max(float64(b), float64(c))))
+}
+
+// image returns the rendered image, averaging blocks of samples x samples pixels
+func (r *rasterizer) image(samples int) *image.RGBA {
+	w, h := r.width/samples, r.height/samples
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	n := float32(samples * samples)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [4]float32
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					i := (y*samples+sy)*r.width + x*samples + sx
+					for k := 0; k < 4; k++ {
+						sum[k] += r.color[4*i+k]
+					}
+				}
+			}
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(clamp(sum[0]/n)*255 + 0.5),
+				G: uint8(clamp(sum[1]/n)*255 + 0.5),
+				B: uint8(clamp(sum[2]/n)*255 + 0.5),
+				A: uint8(clamp(sum[3]/n)*255 + 0.5),
+			})
+		}
+	}
+	return img
+}
+
+// renderBoard renders a board of bw x bh cells with the given tiles into an image of
+// width x height pixels, using the theme's models, light colors and background. Each pixel
+// is sampled samples x samples times for anti-aliasing.
+func renderBoard(theme *Theme, cam Camera, tiles []tileState, bw, bh float32, width, height, samples int) (*image.RGBA, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+	if samples < 1 {
+		samples = 1
+	}
+	top, err := parseColor(theme.Background.Top)
+	if err != nil {
+		return nil, err
+	}
+	bottom, err := parseColor(theme.Background.Bottom)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := newScene(theme, cam, tiles, bw, bh, float32(width)/float32(height))
+	r := newRasterizer(width*samples, height*samples, top, bottom)
+	r.drawScene(sc)
+	return r.image(samples), nil
+}
+
+// parseColor parses a color in the QML notation "#rrggbb" or "#aarrggbb"
+func parseColor(s string) ([4]float32, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if hex == s || len(hex) != 6 && len(hex) != 8 {
+		return [4]float32{}, fmt.Errorf("invalid color %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return [4]float32{}, fmt.Errorf("invalid color %q", s)
+	}
+	a := uint64(0xff)
+	if len(hex) == 8 {
+		a = v >> 24
+	}
+	return [4]float32{
+		float32(v>>16&0xff) / 255,
+		float32(v>>8&0xff) / 255,
+		float32(v&0xff) / 255,
+		float32(a&0xff) / 255,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Recording describes a game completely: since the random tiles are taken from a generator
+// seeded with Seed, replaying the moves leads to exactly the same boards.
+type Recording struct {
+	Seed  int64
+	Moves string // one letter per move: L(eft), R(ight), U(p) or D(own) (Q, E, Z or C diagonally on the hex board), and S for a stone dropped in attack games
+	Start string `json:",omitempty"` // layout the game started from (see parseBoard; default: two random tiles)
+
+	// tiles added after the moves of a puzzle (instead of random ones)
+	Puzzle bool    `json:",omitempty"`
+	Spawns []Spawn `json:",omitempty"`
+
+	// random tiles placed independently of the board, as in versus games
+	Shared bool `json:",omitempty"`
+	// some random tiles are special tiles
+	Specials bool `json:",omitempty"`
+	// merge rule the game is played with (see mergeRules; default: the one of 2048)
+	Rule string `json:",omitempty"`
+	// played on the hex board (see hexTopology)
+	Hex bool `json:",omitempty"`
+}
+
+// recording returns the recording of the current game
+func (b *Board) recording() Recording {
+	return Recording{Seed: b.seed, Moves: string(b.moves), Start: b.start, Puzzle: b.puzzle, Spawns: b.spawns, Shared: b.shared, Specials: b.specials, Rule: b.rule, Hex: b.hex}
+}
+
+// check makes sure the recording only contains valid moves, and a valid start layout
+func (r Recording) check() error {
+	if _, ok := mergeRules[r.Rule]; !ok {
+		return fmt.Errorf("unknown merge rule %q", r.Rule)
+	}
+	b := &Board{}
+	b.setHex(r.Hex)
+	if r.Start != "" {
+		if _, w, h, err := parseBoard(r.Start); err != nil {
+			return err
+		} else if w != b.width || h != b.height {
+			return fmt.Errorf("start layout is %dx%d instead of %dx%d", w, h, b.width, b.height)
+		}
+	}
+	for i := 0; i < len(r.Moves); i++ {
+		if _, _, ok := b.topology().step(r.Moves[i]); !ok && r.Moves[i] != stoneDrop {
+			return fmt.Errorf("invalid move %q at position %d", r.Moves[i], i+1)
+		}
+	}
+	return nil
+}
+
+// readRecording reads a recording from a JSON file
+func readRecording(fileName string) (Recording, error) {
+	var r Recording
+	n, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(n, &r); err != nil {
+		return r, fmt.Errorf("%s: %v", fileName, err)
+	}
+	r.Moves = strings.ToUpper(r.Moves)
+	return r, r.check()
+}
+
+// write writes the recording to a JSON file
+func (r Recording) write(fileName string) error {
+	n, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append(n, '\n'), 0600)
+}
+
+// replayMove executes a recorded move on a simulated board, including what happens at the end
+// of the move animation in the game: merging the tiles and adding a random tile
+func (b *Board) replayMove(dir byte) {
+	if dir == stoneDrop {
+		b.dropStones(1)
+		return
+	}
+	b.move(dir)
+	b.doMerge()
+	if b.moved {
+		b.spawnTile()
+		b.moved = false
+	}
+}
+
+// startFrom starts the game of the recording, without making any moves
+func (b *Board) startFrom(r Recording) error {
+	b.rule = r.Rule
+	b.setHex(r.Hex)
+	if err := b.newGameFrom(r.Seed, r.Start); err != nil {
+		return err
+	}
+	b.puzzle = r.Puzzle
+	b.spawns = r.Spawns
+	b.shared = r.Shared
+	b.specials = r.Specials
+	return nil
+}
+
+// replay returns a simulated board with the state after the first n moves of the recording
+func (r Recording) replay(width, height, n int) *Board {
+	b := &Board{width: width, height: height}
+	b.startFrom(r)
+	for i := 0; i < n && i < len(r.Moves); i++ {
+		b.replayMove(r.Moves[i])
+	}
+	return b
+}
+
+// undo takes back the last move. The board before the move is found by replaying the game
+// without it, which also brings the random generator back to the state it had then, so the
+// recording of the game stays valid. It returns false if there is nothing to undo, or while
+// a move is still being animated.
+func (b *Board) undo() bool {
+	if len(b.moves) == 0 || b.moved {
+		return false
+	}
+	n := len(b.moves) - 1
+	prev := b.recording().replay(b.width, b.height, n)
+
+	b.clear()
+	for _, t := range prev.tiles {
+		if t == nil {
+			continue
+		}
+		if b.ctrl != nil {
+			kind := t.kind
+			t = b.ctrl.createTile(t.Value(), t.x, t.y)
+			t.kind = kind
+		}
+		b.insertTile(t)
+	}
+	b.score = prev.score
+	b.rand = prev.rand
+	b.nextSpawn = prev.nextSpawn
+	b.moves = b.moves[:n]
+	return true
+}
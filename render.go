@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// demoBoard shows every tile value once
+const demoBoard = "2,4,8,16/32,64,128,256/512,1024,2048,0/0,0,0,0"
+
+// parseBoard parses a board description: rows separated by "/", each a comma separated list
+// of tile values (2, 4, 8, ...; 0 for an empty field) or special tiles (see tileKinds: X for
+// a stone, W for a wildcard, B8 for a bomb of value 8 etc.). It returns the tiles and the size
+// of the board.
+func parseBoard(spec string) (tiles []tileState, width, height int, err error) {
+	rows := strings.Split(spec, "/")
+	for y, row := range rows {
+		fields := strings.Split(row, ",")
+		if y == 0 {
+			width = len(fields)
+		} else if len(fields) != width {
+			return nil, 0, 0, fmt.Errorf("row %d has %d fields instead of %d", y+1, len(fields), width)
+		}
+		for x, f := range fields {
+			if kind, nvalue, ok := parseKind(strings.TrimSpace(f)); ok {
+				tiles = append(tiles, tileState{x: float32(x), y: float32(y), scale: 1, alpha: 1, nvalue: nvalue, kind: kind})
+				continue
+			}
+			v, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil || v < 0 || v == 1 || v&(v-1) != 0 {
+				return nil, 0, 0, fmt.Errorf("invalid tile value %q in row %d", f, y+1)
+			}
+			if v == 0 {
+				continue
+			}
+			nvalue := 0
+			for ; v > 1; v >>= 1 {
+				nvalue++
+			}
+			tiles = append(tiles, tileState{x: float32(x), y: float32(y), scale: 1, alpha: 1, nvalue: nvalue})
+		}
+	}
+	return tiles, width, len(rows), nil
+}
+
+// parseSize parses an image size given as "<width>x<height>"
+func parseSize(s string) (width, height int, err error) {
+	if _, err := fmt.Sscanf(s, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q", s)
+	}
+	return width, height, nil
+}
+
+// loadRenderTheme loads the theme with the given name (default: the one selected in the
+// settings) including its models, and returns it with the camera from the settings
+func loadRenderTheme(assetDir, name string) (*Theme, Camera, error) {
+	a := openAssets(assetDir)
+	ts, err := loadThemes(a)
+	if err != nil {
+		return nil, defaultCamera, err
+	}
+	cam := defaultCamera
+	if settings != nil {
+		cam = settings.GetCamera()
+		if name == "" {
+			name = settings.GetTheme()
+		}
+	}
+	theme := findTheme(ts, name)
+	if err := theme.loadModels(a); err != nil {
+		return nil, cam, err
+	}
+	return theme, cam, nil
+}
+
+// renderCommand handles "gofusion render [-o file.png] [-size WxH] [-samples n] [-theme name]
+// [-assets dir] [board]", which renders a board with the software renderer into a PNG image.
+// It needs no OpenGL or display.
+func renderCommand(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	output := fs.String("o", "board.png", "output file")
+	size := fs.String("size", "600x600", "image size in pixels")
+	samples := fs.Int("samples", 2, "samples per pixel in each direction (anti-aliasing)")
+	themeName := fs.String("theme", "", "theme to use (default: the current one)")
+	assetDir := fs.String("assets", "", "directory with assets overriding the built-in ones")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gofusion render [flags] [board]\n\n"+
+			"board lists the tile values row by row, e.g. %q\n\n", demoBoard)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	spec := demoBoard
+	if fs.NArg() > 0 {
+		spec = fs.Arg(0)
+	}
+	tiles, bw, bh, err := parseBoard(spec)
+	if err != nil {
+		return err
+	}
+	width, height, err := parseSize(*size)
+	if err != nil {
+		return err
+	}
+
+	theme, cam, err := loadRenderTheme(*assetDir, *themeName)
+	if err != nil {
+		return err
+	}
+
+	img, err := renderBoard(theme, cam, tiles, float32(bw), float32(bh), width, height, *samples)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s written\n", *output)
+	return nil
+}
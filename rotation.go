@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// AnimationSpec describes a 3D animation of a tile: a rotation around the horizontal axis
+// of the board
+type AnimationSpec struct {
+	Duration int    // in milliseconds; 0 disables the animation
+	Angle    int    // total rotation in degrees
+	Easing   string // name of the easing curve (see easings; default: linear)
+}
+
+// easing maps the linear progress of an animation (0..1) to the progress of the animated value
+type easing func(t float64) float64
+
+// easings holds the easing curves available for tile animations
+var easings = map[string]easing{
+	"linear":    func(t float64) float64 { return t },
+	"inQuad":    func(t float64) float64 { return t * t },
+	"outQuad":   func(t float64) float64 { return t * (2 - t) },
+	"inOutQuad": easeInOutQuad,
+	"outCubic":  func(t float64) float64 { t--; return t*t*t + 1 },
+	"outBack":   easeOutBack,
+	"outBounce": easeOutBounce,
+}
+
+func easeInOutQuad(t float64) float64 {
+	if t < 0.5 {
+		return 2 * t * t
+	}
+	return -1 + (4-2*t)*t
+}
+
+func easeOutBack(t float64) float64 {
+	const s = 1.70158
+	t--
+	return t*t*((s+1)*t+s) + 1
+}
+
+// rotationAnim is a running rotation of a tile
+type rotationAnim struct {
+	tile  *Tile
+	spec  *AnimationSpec
+	ease  easing
+	start time.Time
+
+	// rotation of the tile at the start, and the value shown until the tile has turned
+	// edge-on for the first time (0: the tile's value)
+	from  int
+	shown int
+}
+
+// angle returns the rotation of the tile at time now, and whether the animation is done
+func (a *rotationAnim) angle(now time.Time) (int, bool) {
+	t := float64(now.Sub(a.start)) / float64(time.Duration(a.spec.Duration)*time.Millisecond)
+	if t >= 1 {
+		return 0, true
+	}
+	return a.from + int(math.Round(a.ease(t)*float64(a.spec.Angle))), false
+}
+
+// animateTile starts a rotation of the tile. The tile turns by spec.Angle degrees, ending at its
+// normal orientation; shown is the value displayed until the tile is edge-on, so a flip can
+// reveal a new value (0: no change). Nothing is animated if the spec is disabled or the user
+// prefers reduced motion.
+func (ctrl *Control) animateTile(t *Tile, spec *AnimationSpec, shown int) {
+	if spec == nil || spec.Duration <= 0 || ctrl.reducedMotion {
+		return
+	}
+	ease, ok := easings[spec.Easing]
+	if !ok {
+		ease = easings["linear"]
+	}
+
+	// a new animation replaces a running one of the same tile
+	for i, a := range ctrl.animations {
+		if a.tile == t {
+			ctrl.animations = append(ctrl.animations[:i], ctrl.animations[i+1:]...)
+			break
+		}
+	}
+	a := &rotationAnim{tile: t, spec: spec, ease: ease, start: time.Now(), from: -spec.Angle, shown: shown}
+	ctrl.animations = append(ctrl.animations, a)
+	t.shown = shown
+	t.Rotation = a.from
+	ctrl.AnimationTimer.Set("running", true)
+}
+
+// HandleAnimationFrame is called by the animation timer while tile animations are running.
+// It updates the rotation of the animated tiles according to the elapsed time.
+func (ctrl *Control) HandleAnimationFrame() {
+	now := time.Now()
+	running := ctrl.animations[:0]
+	for _, a := range ctrl.animations {
+		angle, done := a.angle(now)
+		a.tile.Rotation = angle
+		// reveal the new value once the tile is edge-on (at 90 or 270 degrees)
+		if a.tile.shown != 0 && angle-a.from >= 90 {
+			a.tile.shown = 0
+		}
+		if done {
+			a.tile.shown = 0
+			continue
+		}
+		running = append(running, a)
+	}
+	ctrl.animations = running
+	if len(ctrl.animations) == 0 {
+		ctrl.AnimationTimer.Set("running", false)
+	}
+	ctrl.updateBoard()
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// mergeRule decides which tiles merge and what they turn into. The values of the tiles are
+// levels starting at 1; the rule also decides the number shown for each level.
+type mergeRule interface {
+	// merge returns the level of the tile created when a tile of level a moves onto a tile of
+	// level b; ok is false if they don't merge
+	merge(a, b int) (v int, ok bool)
+	// points returns the points scored for creating a tile of level v by merging
+	points(v int) int
+	// number returns the number shown on tiles of level v
+	number(v int) int
+	// spawn returns the level of a new random tile
+	spawn(r *rand.Rand) int
+	// goal returns the level of the tile which wins the game
+	goal() int
+	// slide returns how many fields a tile moves at most in one move (0: as far as it can)
+	slide() int
+}
+
+// mergeRules are the rule sets by name; the default rule "" is the one of 2048
+var mergeRules = map[string]mergeRule{
+	"":          classicRule{},
+	"threes":    threesRule{},
+	"fibonacci": fibonacciRule{},
+	"triples":   triplesRule{},
+}
+
+// ruleNames returns the names of the rule sets, for the usage message
+func ruleNames() string {
+	var names []string
+	for name := range mergeRules {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// ruleLabel returns the name of a rule set as shown to the user
+func ruleLabel(name string) string {
+	if name == "" {
+		return "Classic"
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// mergeRule returns the rule set the game on the board is played with
+func (b *Board) mergeRule() mergeRule {
+	if r, ok := mergeRules[b.rule]; ok {
+		return r
+	}
+	return classicRule{}
+}
+
+// classicRule: equal tiles merge into their sum, 2 + 2 = 4, 4 + 4 = 8 and so on up to 2048
+type classicRule struct{}
+
+func (classicRule) merge(a, b int) (int, bool) {
+	return a + 1, a == b && a < maxTileValue
+}
+
+func (classicRule) points(v int) int {
+	return 1 << uint(v)
+}
+
+func (classicRule) number(v int) int {
+	return 1 << uint(v)
+}
+
+// spawn takes the same numbers from the generator as the game always did, so older
+// recordings still replay correctly
+func (classicRule) spawn(r *rand.Rand) int {
+	return r.Intn(2) + 1
+}
+
+func (classicRule) goal() int  { return maxTileValue }
+func (classicRule) slide() int { return 0 }
+
+// threesRule: 1 + 2 = 3, then equal tiles from 3 up merge into their sum (3 + 3 = 6, 6 + 6 = 12
+// etc.), and tiles move by one field only. Merging into 3 * 2^n scores 3^(n+1) points.
+type threesRule struct{}
+
+func (r threesRule) merge(a, b int) (int, bool) {
+	if a+b == 3 && a != b {
+		return 3, true
+	}
+	return a + 1, a == b && a >= 3 && a < r.goal()
+}
+
+func (threesRule) points(v int) int {
+	p := 1
+	for i := 2; i < v; i++ {
+		p *= 3
+	}
+	return p
+}
+
+func (threesRule) number(v int) int {
+	if v <= 3 {
+		return v
+	}
+	return 3 << uint(v-3)
+}
+
+func (threesRule) spawn(r *rand.Rand) int {
+	return r.Intn(3) + 1
+}
+
+func (threesRule) goal() int  { return 11 } // 768
+func (threesRule) slide() int { return 1 }
+
+// fibonacciRule: the tiles are Fibonacci numbers, and neighbors in the sequence merge into the
+// next one (1 + 1 = 2, 1 + 2 = 3, 2 + 3 = 5 etc.), scoring the number created
+type fibonacciRule struct{}
+
+func (r fibonacciRule) merge(a, b int) (int, bool) {
+	if a == 1 && b == 1 {
+		return 2, true
+	}
+	if a < b {
+		a, b = b, a
+	}
+	return a + 1, a-b == 1 && a < r.goal()
+}
+
+func (r fibonacciRule) points(v int) int {
+	return r.number(v)
+}
+
+func (fibonacciRule) number(v int) int {
+	a, b := 1, 2
+	for i := 1; i < v; i++ {
+		a, b = b, a+b
+	}
+	return a
+}
+
+func (fibonacciRule) spawn(r *rand.Rand) int {
+	if r.Intn(4) == 0 {
+		return 2
+	}
+	return 1
+}
+
+func (fibonacciRule) goal() int  { return 15 } // 987
+func (fibonacciRule) slide() int { return 0 }
+
+// triplesRule: the tiles are powers of three, and it takes three equal ones to make the next:
+// two equal tiles make a pair (1 + 1 = 2, 3 + 3 = 6), and a pair merges with a third tile into
+// the next power (2 + 1 = 3, 6 + 3 = 9). Only completed powers score points. Odd levels are the
+// powers of three, even levels the pairs.
+type triplesRule struct{}
+
+func (r triplesRule) merge(a, b int) (int, bool) {
+	if a >= r.goal() || b >= r.goal() {
+		return 0, false
+	}
+	if a == b && a%2 == 1 {
+		return a + 1, true
+	}
+	if a < b {
+		a, b = b, a
+	}
+	return a + 1, a%2 == 0 && a-b == 1
+}
+
+func (r triplesRule) points(v int) int {
+	if v%2 == 0 {
+		return 0
+	}
+	return r.number(v)
+}
+
+func (triplesRule) number(v int) int {
+	n := 1
+	for i := 3; i <= v; i += 2 {
+		n *= 3
+	}
+	if v%2 == 0 {
+		n *= 2
+	}
+	return n
+}
+
+func (triplesRule) spawn(r *rand.Rand) int {
+	if r.Intn(4) == 0 {
+		return 3
+	}
+	return 1
+}
+
+func (triplesRule) goal() int  { return 15 } // 2187
+func (triplesRule) slide() int { return 0 }
+
+// ### MODELS ###
+
+// numberModels caches the generated models of tiles with numbers other than powers of two
+var (
+	numberMutex  sync.Mutex
+	numberModels = make(map[int]map[string]*Object)
+)
+
+// numberModel returns the model of a tile showing the given number
+func numberModel(number int) map[string]*Object {
+	numberMutex.Lock()
+	defer numberMutex.Unlock()
+	m, ok := numberModels[number]
+	if !ok {
+		m = generateTileModel(number)
+		numberModels[number] = m
+	}
+	return m
+}
+
+// model returns the model of the tile and the nvalue to place it by (see tileMatrix): the model
+// of the theme, or a generated one for numbers which are not powers of two
+func (t tileState) model(theme *Theme) (map[string]*Object, int) {
+	if t.kind == tileNumber && t.number != 0 && t.number != 1<<uint(t.nvalue) {
+		return numberModel(t.number), 0
+	}
+	return theme.tileModel(t.nvalue, t.kind), t.nvalue
+}
+
+// tileState returns the state of a tile resting on its field
+func (b *Board) tileState(t *Tile) tileState {
+	x, y := b.topology().pos(t.x, t.y)
+	return tileState{
+		x:        x,
+		y:        y,
+		scale:    1,
+		alpha:    1,
+		nvalue:   t.Value(),
+		number:   b.mergeRule().number(t.Value()),
+		rotation: t.Rotation,
+		kind:     t.kind,
+	}
+}
+
+// ### RULE SELECTION ###
+
+// HandleRuleButton switches to the next rule set and starts a new game with it
+func (ctrl *Control) HandleRuleButton() {
+	var names []string
+	for name := range mergeRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	i := 0
+	for i < len(names) && names[i] != ctrl.rule {
+		i++
+	}
+	ctrl.setRule(names[(i+1)%len(names)])
+	if ctrl.settings != nil {
+		ctrl.settings.SetRule(ctrl.rule)
+	}
+	ctrl.HandleClassicGame()
+	ctrl.SetMessage(ruleLabel(ctrl.rule)+" rules", ruleHelp[ctrl.rule])
+}
+
+// ruleHelp explains the rule sets in a few words
+var ruleHelp = map[string]string{
+	"":          "equal tiles merge - reach 2048",
+	"threes":    "1 + 2 = 3, then equal tiles merge, tiles move one field - reach 768",
+	"fibonacci": "neighbors in the Fibonacci sequence merge - reach 987",
+	"triples":   "three equal tiles make the next power of three - reach 2187",
+}
+
+// setRule selects the rule set for normal games
+func (ctrl *Control) setRule(name string) {
+	ctrl.rule = name
+	ctrl.LevelScreen.ObjectByName("ruleButton").Set("text", "Rules: "+ruleLabel(name))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestRuleMerges(t *testing.T) {
+	tests := []struct {
+		rule   string
+		a, b   int
+		want   int // level of the merged tile, 0 if the tiles don't merge
+		points int
+	}{
+		{"", 1, 1, 2, 4},
+		{"", 3, 3, 4, 16},
+		{"", 1, 2, 0, 0},
+		{"", maxTileValue, maxTileValue, 0, 0},
+
+		{"threes", 1, 2, 3, 3},
+		{"threes", 2, 1, 3, 3},
+		{"threes", 1, 1, 0, 0},
+		{"threes", 2, 2, 0, 0},
+		{"threes", 3, 3, 4, 9},
+		{"threes", 4, 4, 5, 27},
+		{"threes", 3, 4, 0, 0},
+		{"threes", 11, 11, 0, 0},
+
+		{"fibonacci", 1, 1, 2, 2},
+		{"fibonacci", 1, 2, 3, 3},
+		{"fibonacci", 3, 2, 4, 5},
+		{"fibonacci", 2, 2, 0, 0},
+		{"fibonacci", 1, 3, 0, 0},
+		{"fibonacci", 15, 14, 0, 0},
+
+		{"triples", 1, 1, 2, 0},
+		{"triples", 2, 1, 3, 3},
+		{"triples", 1, 2, 3, 3},
+		{"triples", 3, 3, 4, 0},
+		{"triples", 4, 3, 5, 9},
+		{"triples", 2, 2, 0, 0},
+		{"triples", 3, 2, 0, 0},
+		{"triples", 15, 15, 0, 0},
+	}
+	for _, tt := range tests {
+		r := mergeRules[tt.rule]
+		v, ok := r.merge(tt.a, tt.b)
+		if !ok {
+			v = 0
+		}
+		if v != tt.want {
+			t.Errorf("%s: %d onto %d gives %d, want %d", ruleLabel(tt.rule), tt.a, tt.b, v, tt.want)
+			continue
+		}
+		if ok && r.points(v) != tt.points {
+			t.Errorf("%s: %d onto %d scores %d, want %d", ruleLabel(tt.rule), tt.a, tt.b, r.points(v), tt.points)
+		}
+	}
+}
+
+func TestRuleSpawnAndSlide(t *testing.T) {
+	tests := []struct {
+		rule   string
+		spawns []int // levels of the new tiles
+		slide  int
+	}{
+		{"", []int{1, 2}, 0},
+		{"threes", []int{1, 2, 3}, 1},
+		{"fibonacci", []int{1, 2}, 0},
+		{"triples", []int{1, 3}, 0},
+	}
+	for _, tt := range tests {
+		r := mergeRules[tt.rule]
+		if s := r.slide(); s != tt.slide {
+			t.Errorf("%s: slide is %d, want %d", ruleLabel(tt.rule), s, tt.slide)
+		}
+		seen := make(map[int]bool)
+		rnd := rand.New(rand.NewSource(1))
+		for i := 0; i < 1000; i++ {
+			seen[r.spawn(rnd)] = true
+		}
+		if len(seen) != len(tt.spawns) {
+			t.Errorf("%s: spawns levels %v, want %v", ruleLabel(tt.rule), seen, tt.spawns)
+		}
+		for _, v := range tt.spawns {
+			if !seen[v] {
+				t.Errorf("%s: never spawns level %d", ruleLabel(tt.rule), v)
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Camera describes the view on the board
+type Camera struct {
+	FieldOfView float32 // vertical field of view in degrees
+	Tilt        float32 // rotation of the board away from the viewer in degrees
+	Distance    float32 // distance relative to the one at which the board just fits into the view (0 means 1)
+}
+
+var defaultCamera = Camera{FieldOfView: 30, Tilt: 20, Distance: 1}
+
+// size of one grid cell in model units (the tile models are 3 units wide)
+const cellSize = 3
+
+// heights of the board base and the plane the shadows are projected onto
+const (
+	baseTop     = -0.05
+	baseBottom  = -0.6
+	shadowPlane = baseTop + 0.005
+)
+
+var shadowColor = []float32{0, 0, 0, 0.35}
+
+// ambient light of the scene, as the OpenGL default GL_LIGHT_MODEL_AMBIENT
+// which the fixed-function renderer relies on
+const globalAmbient = 0.2
+
+// fov returns the field of view, falling back to the default for invalid values
+func (c Camera) fov() float32 {
+	if c.FieldOfView <= 0 || c.FieldOfView >= 180 {
+		return defaultCamera.FieldOfView
+	}
+	return c.FieldOfView
+}
+
+// viewMatrix returns the camera transformation for a board of the given size (in model units)
+// shown in a view with the given aspect ratio, and the distance of the camera from the board
+func (c Camera) viewMatrix(w, h, aspect float32) (mat4, float32) {
+	t := float32(math.Tan(float64(c.fov()) * math.Pi / 360))
+
+	// fit the board with a margin of half a tile
+	fit := (h/2 + cellSize/2) / t
+	if f := (w/2 + cellSize/2) / (t * aspect); f > fit {
+		fit = f
+	}
+	d := fit
+	if c.Distance > 0 {
+		d *= c.Distance
+	}
+	return identity().translate(0, 0, -d).rotate(-c.Tilt, 1, 0, 0), d
+}
+
+// projectionMatrix returns the perspective projection for the camera at the given distance
+func (c Camera) projectionMatrix(aspect, dist float32) mat4 {
+	near, far := dist/10, dist*3
+	top := near * float32(math.Tan(float64(c.fov())*math.Pi/360))
+	right := top * aspect
+	return frustum(-right, right, -top, top, near, far)
+}
+
+// tileState is the state of a tile as far as painting is concerned
+type tileState struct {
+	x, y     float32 // position of the top left corner in grid cells
+	scale    float32 // 1 is full size
+	alpha    float32 // opacity
+	nvalue   int
+	number   int // number shown on the tile, as given by the merge rule (0: 2^nvalue)
+	rotation int
+	kind     tileKind
+}
+
+// drawItem is a group of a model, together with everything needed to draw it
+type drawItem struct {
+	group     *Group
+	model     mat4      // model matrix (model to world coordinates)
+	light     []float32 // specular light color
+	ambient   []float32 // material colors, with the tile opacity applied
+	diffuse   []float32
+	specular  []float32
+	shininess float32
+	depth     float32 // view space depth of the tile, for sorting
+}
+
+// transparent reports whether the item has to be drawn in the transparent pass
+func (d *drawItem) transparent() bool {
+	return d.diffuse[3] < 1
+}
+
+// withAlpha returns a copy of the color with its alpha multiplied by alpha
+func withAlpha(c []float32, alpha float32) []float32 {
+	return []float32{c[0], c[1], c[2], c[3] * alpha}
+}
+
+// scene describes everything needed to paint a board, independent of the renderer:
+// camera, light, board base and the groups of all tile models
+type scene struct {
+	theme *Theme
+	w, h  float32 // size of the board in model units
+	view  mat4
+	proj  mat4
+	light [4]float32 // light position in world coordinates
+
+	base   *drawItem
+	shadow mat4 // projects the tiles onto the board base (world coordinates)
+
+	// tiles, opaque ones first, then the transparent ones from back to front
+	items       []*drawItem
+	transparent int // index of the first transparent item
+}
+
+// newScene sets up the scene for a board of bw x bh cells with the given tiles,
+// shown in a view with the given aspect ratio
+func newScene(theme *Theme, cam Camera, tiles []tileState, bw, bh float32, aspect float32) *scene {
+	w, h := cellSize*bw, cellSize*bh
+	sc := &scene{theme: theme, w: w, h: h}
+
+	var dist float32
+	sc.view, dist = cam.viewMatrix(w, h, aspect)
+	sc.proj = cam.projectionMatrix(aspect, dist)
+
+	// light above the top left corner of the board
+	sc.light = [4]float32{-0.4 * w, 0.6 * h, 2 * w, 1}
+	sc.shadow = shadowMatrix(shadowPlane, sc.light)
+
+	sc.base = &drawItem{
+		group:    baseBox(w, h),
+		model:    identity(),
+		light:    defaultLightColor,
+		ambient:  theme.BoardColor,
+		diffuse:  theme.BoardColor,
+		specular: []float32{0, 0, 0, 1},
+	}
+
+	var opaque, transparent []*drawItem
+	for _, t := range tiles {
+		if t.scale <= 0 || t.alpha <= 0 {
+			continue
+		}
+		model, nvalue := t.model(theme)
+		m := tileMatrix(theme, t.x, t.y, t.scale, w, h, nvalue, t.rotation)
+		center := sc.view.mul(m).transformPoint([3]float32{0, 0, 0})
+		light := theme.LightColor(t.nvalue)
+		for _, obj := range sortedObjects(model) {
+			for _, g := range obj.Groups {
+				it := &drawItem{
+					group:     g,
+					model:     m,
+					light:     light,
+					ambient:   withAlpha(g.Material.Ambient, t.alpha),
+					diffuse:   withAlpha(g.Material.Diffuse, t.alpha),
+					specular:  withAlpha(g.Material.Specular, t.alpha),
+					shininess: g.Material.Shininess,
+					depth:     center[2],
+				}
+				if it.transparent() {
+					transparent = append(transparent, it)
+				} else {
+					opaque = append(opaque, it)
+				}
+			}
+		}
+	}
+	sort.SliceStable(transparent, func(i, j int) bool { return transparent[i].depth < transparent[j].depth })
+	sc.items = append(opaque, transparent...)
+	sc.transparent = len(opaque)
+	return sc
+}
+
+// baseBoxes caches the board bases by size, so renderers can keep them in GPU memory
+var (
+	baseMutex sync.Mutex
+	baseBoxes = make(map[[2]float32]*Group)
+)
+
+// baseBox returns the board base for a board of size w x h (in model units)
+func baseBox(w, h float32) *Group {
+	baseMutex.Lock()
+	defer baseMutex.Unlock()
+	g, ok := baseBoxes[[2]float32{w, h}]
+	if !ok {
+		g = boxGroup([3]float32{-w / 2, -h / 2, baseBottom}, [3]float32{w / 2, h / 2, baseTop}, nil)
+		baseBoxes[[2]float32{w, h}] = g
+	}
+	return g
+}
+
+// tileMatrix returns the model matrix for a tile with its top left corner at the given cell
+// coordinates (which don't have to be whole numbers while the tile is moving) on a board of
+// size w x h. The transformations in the tile models place the tile in a 3 x 3 square with the
+// origin at its bottom left corner, as in the painted QML item; the tile shrinks towards its
+// top left corner like the QML item does.
+func tileMatrix(theme *Theme, cx, cy, scale float32, w, h float32, nvalue, rotation int) mat4 {
+	return identity().
+		translate(-w/2+cellSize*cx, h/2-cellSize*cy, 0).
+		scale(scale, scale, scale).
+		translate(0, -cellSize, 0).
+		mul(theme.tileTransform(nvalue, rotation))
+}
+
+// shadowMatrix returns the matrix projecting geometry onto the plane z = height,
+// as seen from the light at position light (world coordinates, w = 1)
+func shadowMatrix(height float32, light [4]float32) mat4 {
+	plane := [4]float32{0, 0, 1, -height}
+	dot := plane[0]*light[0] + plane[1]*light[1] + plane[2]*light[2] + plane[3]*light[3]
+	var m mat4
+	for col := 0; col < 4; col++ {
+		for row := 0; row < 4; row++ {
+			v := -light[row] * plane[col]
+			if row == col {
+				v += dot
+			}
+			m[col*4+row] = v
+		}
+	}
+	return m
+}
+
+// project returns the pixel position in a view of the given size of the point x, y (in cells)
+// on the surface of the board base
+func (sc *scene) project(x, y, width, height float32) (px, py float32) {
+	p := sc.proj.mul(sc.view).transform4([3]float32{-sc.w/2 + cellSize*x, sc.h/2 - cellSize*y, baseTop})
+	return (p[0]/p[3] + 1) / 2 * width, (1 - p[1]/p[3]) / 2 * height
+}
+
+// fieldAt returns the cell of a board of the given topology shown at pixel px, py of a view of
+// the given size
+func (sc *scene) fieldAt(px, py, width, height float32, topo topology) (x, y int, ok bool) {
+	for _, c := range cells(topo) {
+		var q [][2]float32
+		for _, p := range topo.outline(c[0], c[1]) {
+			x, y := sc.project(p[0], p[1], width, height)
+			q = append(q, [2]float32{x, y})
+		}
+		if insidePolygon(q, px, py) {
+			return c[0], c[1], true
+		}
+	}
+	return 0, 0, false
+}
+
+// insidePolygon returns whether the point px, py is inside the convex polygon q
+func insidePolygon(q [][2]float32, px, py float32) bool {
+	var pos, neg bool
+	for i := range q {
+		a, b := q[i], q[(i+1)%len(q)]
+		c := (b[0]-a[0])*(py-a[1]) - (b[1]-a[1])*(px-a[0])
+		pos = pos || c > 0
+		neg = neg || c < 0
+	}
+	return !(pos && neg)
+}
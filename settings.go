@@ -6,16 +6,45 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/user"
 )
 
 // Global Settings for the program
 type GlobalSettings struct {
-	Username string // username
-	HiScore  uint32 // hiscore for user
+	Username         string                    // username, also the name of the profile the puzzle progress is stored for
+	HiScore          uint32                    // hiscore for user
+	AssetDir         string                    // directory with assets overriding the built-in ones
+	Theme            string                    // name of the selected theme
+	Camera           *Camera                   // view on the board (nil: default)
+	Renderer         string                    // "shader" (default) or "fixed" for the OpenGL fixed-function pipeline
+	ReducedMotion    bool                      // disable the 3D tile animations
+	Effects          string                    // intensity of the particle effects: "high" (default), "medium", "low" or "off"
+	Scale            float64                   // scale factor of the user interface (0: from the pixel density of the screen)
+	Window           *WindowGeometry           // position and size of the window when the game was last closed (nil: default)
+	Bindings         map[string][]string       // keys and gamepad buttons per action (actions left out keep their defaults)
+	Gamepad          string                    // evdev device of the gamepad (default: the first joystick found; "off": none)
+	Gamepad2         string                    // evdev device of the second player's gamepad in versus games (default: the second joystick found; "off": none)
+	QueueDepth       int                       // number of moves buffered while the tiles are moving (0: default)
+	SkipAnimations   int                       // number of buffered moves from which moves are not animated (0: never)
+	SwipeSensitivity float64                   // higher values recognize shorter and slower swipes (0: default of 1)
+	Puzzles          map[string]map[string]int // per profile (Username), the fewest moves each solved puzzle level took
+	Daily            *DailyResult              // result of the last daily challenge
+	DailyBest        int                       // best score in daily challenges (kept apart from HiScore)
+	DailyStreak      int                       // number of days in a row the daily challenge has been played
+	VersusTarget     int                       // tile value which wins a versus game (0: 2048)
+	Server           string                    // address of the match server for online games (default: localhost:7048)
+	Rule             string                    // merge rule of normal games: "threes", "fibonacci" or "triples" (default: the one of 2048)
 
 	fileName string
 }
 
+// WindowGeometry holds the position and size of the game window
+type WindowGeometry struct {
+	X, Y          int
+	Width, Height int
+	Fullscreen    bool
+}
+
 // Constructor
 func NewGlobalSettings(fileName string) *GlobalSettings {
 	g := new(GlobalSettings)
@@ -33,6 +62,171 @@ func (g *GlobalSettings) SetHiScore(v uint32) {
 	g.writeToFile()
 }
 
+func (g *GlobalSettings) GetAssetDir() string {
+	g.readFromFile()
+	return g.AssetDir
+}
+
+func (g *GlobalSettings) GetTheme() string {
+	g.readFromFile()
+	return g.Theme
+}
+
+func (g *GlobalSettings) SetTheme(v string) {
+	g.Theme = v
+	g.writeToFile()
+}
+
+func (g *GlobalSettings) GetCamera() Camera {
+	g.readFromFile()
+	if g.Camera == nil {
+		return defaultCamera
+	}
+	return *g.Camera
+}
+
+func (g *GlobalSettings) GetRenderer() string {
+	g.readFromFile()
+	return g.Renderer
+}
+
+func (g *GlobalSettings) GetReducedMotion() bool {
+	g.readFromFile()
+	return g.ReducedMotion
+}
+
+func (g *GlobalSettings) GetEffects() string {
+	g.readFromFile()
+	return g.Effects
+}
+
+func (g *GlobalSettings) GetScale() float64 {
+	g.readFromFile()
+	return g.Scale
+}
+
+func (g *GlobalSettings) GetWindow() *WindowGeometry {
+	g.readFromFile()
+	return g.Window
+}
+
+func (g *GlobalSettings) SetWindow(v WindowGeometry) {
+	g.Window = &v
+	g.writeToFile()
+}
+
+func (g *GlobalSettings) GetBindings() map[string][]string {
+	g.readFromFile()
+	return g.Bindings
+}
+
+func (g *GlobalSettings) SetBindings(v map[string][]string) {
+	g.Bindings = v
+	g.writeToFile()
+}
+
+func (g *GlobalSettings) GetGamepad() string {
+	g.readFromFile()
+	return g.Gamepad
+}
+
+func (g *GlobalSettings) GetGamepad2() string {
+	g.readFromFile()
+	return g.Gamepad2
+}
+
+func (g *GlobalSettings) GetVersusTarget() int {
+	g.readFromFile()
+	return g.VersusTarget
+}
+
+func (g *GlobalSettings) GetServer() string {
+	g.readFromFile()
+	return g.Server
+}
+
+func (g *GlobalSettings) GetRule() string {
+	g.readFromFile()
+	return g.Rule
+}
+
+func (g *GlobalSettings) SetRule(v string) {
+	g.Rule = v
+	g.writeToFile()
+}
+
+func (g *GlobalSettings) GetQueueDepth() int {
+	g.readFromFile()
+	return g.QueueDepth
+}
+
+func (g *GlobalSettings) GetSkipAnimations() int {
+	g.readFromFile()
+	return g.SkipAnimations
+}
+
+func (g *GlobalSettings) GetSwipeSensitivity() float64 {
+	g.readFromFile()
+	return g.SwipeSensitivity
+}
+
+// GetPuzzleProgress returns the puzzle levels solved by the current profile, with the fewest
+// moves they took, by "<pack>/<level number>"
+func (g *GlobalSettings) GetPuzzleProgress() map[string]int {
+	g.readFromFile()
+	return g.Puzzles[g.profile()]
+}
+
+func (g *GlobalSettings) SetPuzzleProgress(level string, moves int) {
+	if g.Puzzles == nil {
+		g.Puzzles = make(map[string]map[string]int)
+	}
+	p := g.profile()
+	if g.Puzzles[p] == nil {
+		g.Puzzles[p] = make(map[string]int)
+	}
+	g.Puzzles[p][level] = moves
+	g.writeToFile()
+}
+
+// profile returns the name of the current profile: the user name from the settings, or the
+// login name
+func (g *GlobalSettings) profile() string {
+	if g.Username != "" {
+		return g.Username
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+func (g *GlobalSettings) GetDaily() *DailyResult {
+	g.readFromFile()
+	return g.Daily
+}
+
+func (g *GlobalSettings) SetDaily(v DailyResult, streak int) {
+	g.Daily = &v
+	g.DailyStreak = streak
+	g.writeToFile()
+}
+
+func (g *GlobalSettings) GetDailyBest() int {
+	g.readFromFile()
+	return g.DailyBest
+}
+
+func (g *GlobalSettings) SetDailyBest(v int) {
+	g.DailyBest = v
+	g.writeToFile()
+}
+
+func (g *GlobalSettings) GetDailyStreak() int {
+	g.readFromFile()
+	return g.DailyStreak
+}
+
 // get name of settings file
 func (g *GlobalSettings) getFileName() string {
 	return g.fileName
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Theme describes the look of the game: the colors and models of the tiles, the background,
+// the font and the particle image. Themes are read from "themes/<name>/theme.json" in the
+// assets; file names given in the manifest are relative to the directory of the manifest.
+// Everything that is left out falls back to the built-in defaults.
+type Theme struct {
+	Name string
+
+	// specular light color per tile value (2, 4, 8, ...) as RGBA
+	LightColors map[int][]float32
+	// printf pattern for the tile model files, formatted with the tile value
+	// (default: the built-in models "model/tile_%04d.obj")
+	Models string
+	// colors of the background gradient
+	Background struct {
+		Top    string
+		Bottom string
+	}
+	// color (RGBA) of the board base the tiles lie on
+	BoardColor []float32
+	// font family used for all texts (default: system font)
+	Font string
+	// image used for the particle effects (default: the built-in "particle.png")
+	Particle string
+	// particle effect shown when tiles merge
+	Particles *ParticlePreset
+	// 3D animations of the tiles when merging, appearing and reaching 2048
+	Animations struct {
+		Merge *AnimationSpec
+		Spawn *AnimationSpec
+		Win   *AnimationSpec
+	}
+
+	dir string
+
+	// models per nvalue; missing ones are generated on demand
+	mutex     sync.Mutex
+	models    map[int]map[string]*Object
+	generated map[int]bool
+}
+
+// defaultLightColor is used for tile values without a light color in the theme
+var defaultLightColor = []float32{0.3, 0.3, 0.3, 1.0}
+
+// currentTheme is the theme used for painting the tiles
+var currentTheme *Theme
+
+// loadThemes reads all theme manifests present in the assets, sorted by name
+func loadThemes(a *Assets) ([]*Theme, error) {
+	root, err := a.Root()
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := filepath.Glob(filepath.Join(root, "themes", "*", "theme.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var themes []*Theme
+	for _, m := range manifests {
+		t, err := loadTheme(m)
+		if err != nil {
+			return nil, err
+		}
+		themes = append(themes, t)
+	}
+	if len(themes) == 0 {
+		return nil, fmt.Errorf("no themes found in %s", filepath.Join(root, "themes"))
+	}
+	sort.Slice(themes, func(i, j int) bool { return themes[i].Name < themes[j].Name })
+	return themes, nil
+}
+
+// loadTheme reads a theme manifest
+func loadTheme(fileName string) (*Theme, error) {
+	n, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	t := new(Theme)
+	if err := json.Unmarshal(n, t); err != nil {
+		return nil, fmt.Errorf("cannot read theme %s: %v", fileName, err)
+	}
+	t.dir = filepath.Dir(fileName)
+	if t.Name == "" {
+		t.Name = filepath.Base(t.dir)
+	}
+	if t.Background.Top == "" {
+		t.Background.Top = "#001166"
+	}
+	if t.Background.Bottom == "" {
+		t.Background.Bottom = "#001133"
+	}
+	if len(t.BoardColor) != 4 {
+		t.BoardColor = []float32{0.05, 0.07, 0.2, 1.0}
+	}
+	if t.Particles == nil {
+		t.Particles = new(ParticlePreset)
+	}
+	t.Particles.setDefaults()
+	if t.Animations.Merge == nil {
+		t.Animations.Merge = &AnimationSpec{Duration: 400, Angle: 360, Easing: "inOutQuad"}
+	}
+	if t.Animations.Spawn == nil {
+		t.Animations.Spawn = &AnimationSpec{Duration: 300, Angle: 90, Easing: "outBack"}
+	}
+	if t.Animations.Win == nil {
+		t.Animations.Win = &AnimationSpec{Duration: 1500, Angle: 720, Easing: "outCubic"}
+	}
+	for _, a := range []*AnimationSpec{t.Animations.Merge, t.Animations.Spawn, t.Animations.Win} {
+		if _, ok := easings[a.Easing]; !ok && a.Easing != "" {
+			return nil, fmt.Errorf("theme %s: unknown easing curve %q", fileName, a.Easing)
+		}
+	}
+	return t, nil
+}
+
+// defaultTheme is the name of the theme used when none (or an unknown one) is selected
+const defaultTheme = "Night"
+
+// findTheme returns the theme with the given name (ignoring case), or the default theme if
+// there is none. If the default theme doesn't exist either, the first one is returned.
+func findTheme(themes []*Theme, name string) *Theme {
+	for _, t := range themes {
+		if strings.EqualFold(t.Name, name) {
+			return t
+		}
+	}
+	for _, t := range themes {
+		if t.Name == defaultTheme {
+			return t
+		}
+	}
+	return themes[0]
+}
+
+// loadModels loads the 3D models for the tiles, unless this has already been done.
+// Model files which don't exist are skipped; these models are generated when needed.
+func (t *Theme) loadModels(a *Assets) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.models != nil {
+		return nil
+	}
+
+	models := make(map[int]map[string]*Object)
+	for i := 1; i <= maxTileValue; i++ {
+		path, err := t.modelPath(a, i)
+		if err != nil {
+			return err
+		}
+		models[i], err = Read(path)
+		if os.IsNotExist(err) {
+			delete(models, i)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	t.models = models
+	t.generated = make(map[int]bool)
+	return nil
+}
+
+// model returns the model for the tile with the given nvalue,
+// generating it if the theme has none
+func (t *Theme) model(nvalue int) map[string]*Object {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	m, ok := t.models[nvalue]
+	if !ok {
+		m = generateTileModel(1 << uint(nvalue))
+		t.models[nvalue] = m
+		t.generated[nvalue] = true
+	}
+	return m
+}
+
+// offsetModel reports whether the model for the given nvalue is the artist model of the
+// 2048 tile, which isn't centered and rotated like the others and needs special treatment
+// when painting
+func (t *Theme) offsetModel(nvalue int) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return nvalue == 11 && !t.generated[nvalue]
+}
+
+// tileTransform returns the transformation which Tile.Paint applies to the model of a tile
+// with the given nvalue, in units of a third of the tile size
+func (t *Theme) tileTransform(nvalue, rotation int) mat4 {
+	m := identity().translate(1.5, 1.5, 0)
+	if !t.offsetModel(nvalue) {
+		m = m.rotate(-90, 0, 0, 1)
+	} else {
+		m = m.translate(0.48, -0.45, 0)
+	}
+	return m.rotate(float32(90+((36000+rotation)%360)), 1, 0, 0)
+}
+
+// modelPath returns the path of the model file for the tile with the given nvalue
+func (t *Theme) modelPath(a *Assets, nvalue int) (string, error) {
+	if t.Models == "" {
+		return a.Path(fmt.Sprintf("model/tile_%04d.obj", 1<<uint(nvalue)))
+	}
+	return filepath.Join(t.dir, fmt.Sprintf(t.Models, 1<<uint(nvalue))), nil
+}
+
+// LightColor returns the specular light color for the tile with the given nvalue
+func (t *Theme) LightColor(nvalue int) []float32 {
+	if c, ok := t.LightColors[1<<uint(nvalue)]; ok && len(c) == 4 {
+		return c
+	}
+	return defaultLightColor
+}
+
+// ParticleSource returns the URL of the particle image for use in QML
+// (an empty string means the built-in image)
+func (t *Theme) ParticleSource() string {
+	if t.Particle == "" {
+		return ""
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(t.dir, t.Particle))}
+	return u.String()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+// dimensions of the generated tiles, matching the artist models in "model"
+const (
+	genTileHalfSize  = 1.118405 // half the edge length of the tile body
+	genTileThickness = 0.148044
+	genCornerRadius  = 0.25
+	genCornerSteps   = 6
+
+	// the digits stand out on both faces of the tile body, so they are visible no matter
+	// which face is shown
+	genDigitHeight  = 0.04
+	genStrokeWidth  = 0.09
+	genDigitSpacing = 0.35 // space between digits, relative to the digit width
+	genTextWidth    = 1.6  // maximum width and height of the number
+	genTextHeight   = 0.7
+)
+
+// vectorFont contains the strokes (polylines) making up the characters, in a cell of
+// width 1 and height 2 with the origin at the bottom left.
+var vectorFont = map[rune][][][2]float32{
+	'0': {{{0, 0}, {1, 0}, {1, 2}, {0, 2}, {0, 0}}},
+	'1': {{{0.2, 1.6}, {0.5, 2}, {0.5, 0}}, {{0.2, 0}, {0.8, 0}}},
+	'2': {{{0, 2}, {1, 2}, {1, 1}, {0, 1}, {0, 0}, {1, 0}}},
+	'3': {{{0, 2}, {1, 2}, {1, 0}, {0, 0}}, {{0.2, 1}, {1, 1}}},
+	'4': {{{0, 2}, {0, 1}, {1, 1}}, {{1, 2}, {1, 0}}},
+	'5': {{{1, 2}, {0, 2}, {0, 1}, {1, 1}, {1, 0}, {0, 0}}},
+	'6': {{{1, 2}, {0, 2}, {0, 0}, {1, 0}, {1, 1}, {0, 1}}},
+	'7': {{{0, 2}, {1, 2}, {0.4, 0}}},
+	'8': {{{0, 0}, {1, 0}, {1, 2}, {0, 2}, {0, 0}}, {{0, 1}, {1, 1}}},
+	'9': {{{0, 0}, {1, 0}, {1, 2}, {0, 2}, {0, 1}, {1, 1}}},
+
+	// letters for the score in exported animations
+	'C': {{{1, 2}, {0, 2}, {0, 0}, {1, 0}}},
+	'E': {{{1, 2}, {0, 2}, {0, 0}, {1, 0}}, {{0, 1}, {0.8, 1}}},
+	'O': {{{0, 0}, {1, 0}, {1, 2}, {0, 2}, {0, 0}}},
+	'R': {{{0, 0}, {0, 2}, {1, 2}, {1, 1}, {0, 1}, {1, 0}}},
+	'S': {{{1, 2}, {0, 2}, {0, 1}, {1, 1}, {1, 0}, {0, 0}}},
+
+	// marks of the special tiles
+	'X': {{{0, 0}, {1, 2}}, {{0, 2}, {1, 0}}},
+	'*': {{{0, 1}, {1, 1}}, {{0.5, 0.2}, {0.5, 1.8}}, {{0.1, 0.4}, {0.9, 1.6}}, {{0.1, 1.6}, {0.9, 0.4}}},
+}
+
+// materials of the generated tiles
+var (
+	genBodyMaterial = &Material{
+		Name:     "GenBody",
+		Ambient:  []float32{0, 0, 0, 1},
+		Diffuse:  []float32{0.8, 0.8, 0.8, 1},
+		Specular: []float32{0.8, 0.8, 0.8, 1},
+	}
+	genDigitMaterial = &Material{
+		Name:      "GenDigits",
+		Ambient:   []float32{0, 0, 0, 1},
+		Diffuse:   []float32{0.15, 0.15, 0.15, 1},
+		Specular:  []float32{1, 1, 1, 1},
+		Shininess: 40,
+	}
+	genStoneMaterial = &Material{
+		Name:     "GenStone",
+		Ambient:  []float32{0, 0, 0, 1},
+		Diffuse:  []float32{0.35, 0.33, 0.3, 1},
+		Specular: []float32{0.1, 0.1, 0.1, 1},
+	}
+	genWildMaterial = &Material{
+		Name:      "GenWild",
+		Ambient:   []float32{0, 0, 0, 1},
+		Diffuse:   []float32{0.6, 0.3, 0.8, 1},
+		Specular:  []float32{0.8, 0.8, 0.8, 1},
+		Shininess: 60,
+	}
+	genBombMaterial = &Material{
+		Name:     "GenBomb",
+		Ambient:  []float32{0, 0, 0, 1},
+		Diffuse:  []float32{0.85, 0.2, 0.15, 1},
+		Specular: []float32{0.8, 0.8, 0.8, 1},
+	}
+	genMultiplierMaterial = &Material{
+		Name:      "GenMultiplier",
+		Ambient:   []float32{0, 0, 0, 1},
+		Diffuse:   []float32{0.9, 0.7, 0.2, 1},
+		Specular:  []float32{1, 0.9, 0.6, 1},
+		Shininess: 80,
+	}
+)
+
+// generateTileModel builds the model of a tile showing the given number: a tile body with
+// rounded corners and the digits of the number on it. The model uses the same coordinate
+// system as the artist models (the tile lies in the x-z plane, the text reads along -z with
+// -x pointing up), so it can be painted just like them.
+func generateTileModel(number int) map[string]*Object {
+	return generateModel(strconv.Itoa(number), strconv.Itoa(number), genBodyMaterial)
+}
+
+// generateKindModel builds the model of a special tile: a tile body in the color of the kind,
+// with the value of the tile or the mark of the kind on it
+func generateKindModel(kind tileKind, nvalue int) map[string]*Object {
+	text := tileKinds[kind].mark
+	if tileKinds[kind].valued {
+		text = strconv.Itoa(1 << uint(nvalue))
+	}
+	return generateModel(kindField(kind, nvalue), text, tileKinds[kind].body)
+}
+
+// generateModel builds a tile body of the given material with text on it
+func generateModel(id, text string, material *Material) map[string]*Object {
+	name := "Tile." + id + "_Generated"
+	obj := &Object{Name: name}
+
+	body := &Group{Name: "body", Material: material}
+	extrudePolygon(body, roundedSquare(genTileHalfSize, genCornerRadius, genCornerSteps), 0, genTileThickness, true)
+	obj.Groups = append(obj.Groups, body)
+
+	digits := &Group{Name: "digits", Material: genDigitMaterial}
+	for _, q := range textStrokes(text) {
+		extrudePolygon(digits, q, -genDigitHeight, genTileThickness+genDigitHeight, false)
+	}
+	obj.Groups = append(obj.Groups, digits)
+
+	return map[string]*Object{name: obj}
+}
+
+// roundedSquare returns the outline of a square centered at the origin with rounded corners,
+// counter-clockwise in (x, z)
+func roundedSquare(half, radius float32, steps int) [][2]float32 {
+	var poly [][2]float32
+	centers := [][2]float32{{half - radius, half - radius}, {-half + radius, half - radius},
+		{-half + radius, -half + radius}, {half - radius, -half + radius}}
+	for c, center := range centers {
+		for i := 0; i <= steps; i++ {
+			a := (float64(c) + float64(i)/float64(steps)) * math.Pi / 2
+			poly = append(poly, [2]float32{center[0] + radius*float32(math.Cos(a)), center[1] + radius*float32(math.Sin(a))})
+		}
+	}
+	return poly
+}
+
+// textStrokes lays out the digits of text centered on the tile and returns one quadrilateral
+// (in x, z) per stroke segment
+func textStrokes(text string) [][][2]float32 {
+	n := float32(len(text))
+	width := n + (n-1)*genDigitSpacing
+	scale := genTextWidth / width
+	if scale > genTextHeight/2 {
+		scale = genTextHeight / 2
+	}
+	u0 := -width * scale / 2
+	v0 := -scale
+
+	var quads [][][2]float32
+	for i, r := range text {
+		cell := u0 + float32(i)*(1+genDigitSpacing)*scale
+		for _, stroke := range vectorFont[r] {
+			for j := 0; j+1 < len(stroke); j++ {
+				p := [2]float32{cell + stroke[j][0]*scale, v0 + stroke[j][1]*scale}
+				q := [2]float32{cell + stroke[j+1][0]*scale, v0 + stroke[j+1][1]*scale}
+				quads = append(quads, strokeQuad(p, q, genStrokeWidth))
+			}
+		}
+	}
+	return quads
+}
+
+// strokeQuad returns the outline of a stroke from p to q (in text coordinates, u to the right
+// and v up) with square caps, converted to (x, z) and oriented counter-clockwise
+func strokeQuad(p, q [2]float32, width float32) [][2]float32 {
+	du, dv := q[0]-p[0], q[1]-p[1]
+	l := float32(math.Sqrt(float64(du*du + dv*dv)))
+	if l == 0 {
+		du, dv, l = 1, 0, 1
+	}
+	// half-width vectors along and across the stroke
+	au, av := du/l*width/2, dv/l*width/2
+	cu, cv := -av, au
+
+	text := [][2]float32{
+		{p[0] - au - cu, p[1] - av - cv},
+		{q[0] + au - cu, q[1] + av - cv},
+		{q[0] + au + cu, q[1] + av + cv},
+		{p[0] - au + cu, p[1] - av + cv},
+	}
+	// text u maps to -z and v to -x; this mirrors the outline, so reverse it
+	var poly [][2]float32
+	for i := len(text) - 1; i >= 0; i-- {
+		poly = append(poly, [2]float32{-text[i][1], -text[i][0]})
+	}
+	return poly
+}
+
+// extrudePolygon adds a prism to the group, made from the convex polygon poly (in x, z,
+// counter-clockwise) extended from y0 to y1. If smooth is set, the normals of the side
+// walls are interpolated between the edges, as suitable for rounded outlines.
+func extrudePolygon(g *Group, poly [][2]float32, y0, y1 float32, smooth bool) {
+	add := func(x, y, z float32, n [3]float32) {
+		g.Vertexes = append(g.Vertexes, x, y, z)
+		g.Normals = append(g.Normals, n[0], n[1], n[2])
+	}
+
+	// caps: a polygon counter-clockwise in (x, z) faces -y
+	down, up := [3]float32{0, -1, 0}, [3]float32{0, 1, 0}
+	for i := 1; i+1 < len(poly); i++ {
+		add(poly[0][0], y0, poly[0][1], down)
+		add(poly[i][0], y0, poly[i][1], down)
+		add(poly[i+1][0], y0, poly[i+1][1], down)
+
+		add(poly[0][0], y1, poly[0][1], up)
+		add(poly[i+1][0], y1, poly[i+1][1], up)
+		add(poly[i][0], y1, poly[i][1], up)
+	}
+
+	// outward normals of the edges
+	n := len(poly)
+	edge := make([][3]float32, n)
+	for i := range poly {
+		a, b := poly[i], poly[(i+1)%n]
+		edge[i] = normalize([3]float32{b[1] - a[1], 0, a[0] - b[0]})
+	}
+	for i := range poly {
+		a, b := poly[i], poly[(i+1)%n]
+		na, nb := edge[i], edge[i]
+		if smooth {
+			prev := edge[(i+n-1)%n]
+			next := edge[(i+1)%n]
+			na = normalize([3]float32{prev[0] + edge[i][0], 0, prev[2] + edge[i][2]})
+			nb = normalize([3]float32{edge[i][0] + next[0], 0, edge[i][2] + next[2]})
+		}
+		add(a[0], y0, a[1], na)
+		add(a[0], y1, a[1], na)
+		add(b[0], y1, b[1], nb)
+
+		add(a[0], y0, a[1], na)
+		add(b[0], y1, b[1], nb)
+		add(b[0], y0, b[1], nb)
+	}
+}
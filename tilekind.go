@@ -0,0 +1,226 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// tileKind distinguishes the tiles with a number from special tiles
+type tileKind int
+
+const (
+	tileNumber     tileKind = iota // a plain tile with a value of 2, 4, 8, ...
+	tileStone                      // an obstacle which never moves and never merges
+	tileWild                       // a wildcard without a value, which merges with any tile with a value
+	tileBomb                       // a tile with a value which clears the fields next to it when it merges
+	tileMultiplier                 // a tile with a value whose merge scores multiplierFactor times the points
+)
+
+// tileKinds describes the special tiles: their name in board layouts (see parseBoard), followed
+// by the value for kinds with a value (e.g. "B8"), and the look of their models
+var tileKinds = map[tileKind]struct {
+	name   string
+	valued bool
+	mark   string // shown on tiles without a value
+	body   *Material
+}{
+	tileStone:      {"X", false, "X", genStoneMaterial},
+	tileWild:       {"W", false, "*", genWildMaterial},
+	tileBomb:       {"B", true, "", genBombMaterial},
+	tileMultiplier: {"M", true, "", genMultiplierMaterial},
+}
+
+// multiplierFactor is the factor by which the points of merges with a multiplier tile are multiplied
+const multiplierFactor = 3
+
+// specialOdds means that one in specialOdds random tiles is a special one in games with
+// special tiles
+const specialOdds = 8
+
+// parseKind parses a special tile in a board layout; ok is false if the field is not one
+func parseKind(field string) (kind tileKind, nvalue int, ok bool) {
+	for k, d := range tileKinds {
+		if !strings.HasPrefix(field, d.name) {
+			continue
+		}
+		rest := field[len(d.name):]
+		if !d.valued {
+			return k, 0, rest == ""
+		}
+		v, err := strconv.Atoi(rest)
+		if err != nil {
+			return tileNumber, 0, false
+		}
+		return k, tileLevel(v), tileLevel(v) > 0
+	}
+	return tileNumber, 0, false
+}
+
+// kindField returns a special tile as written in board layouts
+func kindField(kind tileKind, nvalue int) string {
+	d := tileKinds[kind]
+	if !d.valued {
+		return d.name
+	}
+	return d.name + strconv.Itoa(1<<uint(nvalue))
+}
+
+// immovable returns whether the tile stays where it is when the tiles are moved
+func (t *Tile) immovable() bool {
+	return t.kind == tileStone
+}
+
+// mergesWith returns the value of the tile created when the tile moves onto the other tile, as
+// decided by the merge rule; ok is false if they don't merge. A wildcard merges as a copy of
+// the tile with a value.
+func (t *Tile) mergesWith(o *Tile, rule mergeRule) (v int, ok bool) {
+	if t.immovable() || o.immovable() || o.NextValue != 0 {
+		return 0, false
+	}
+	switch {
+	case t.kind == tileWild && o.kind == tileWild:
+		return 0, false
+	case t.kind == tileWild:
+		return rule.merge(o.Value(), o.Value())
+	case o.kind == tileWild:
+		return rule.merge(t.Value(), t.Value())
+	}
+	return rule.merge(t.Value(), o.Value())
+}
+
+// mergePoints returns the points scored by merging the tile with the other one into a tile
+// of the given value
+func (t *Tile) mergePoints(o *Tile, v int, rule mergeRule) int {
+	points := rule.points(v)
+	if t.kind == tileMultiplier || o.kind == tileMultiplier {
+		points *= multiplierFactor
+	}
+	return points
+}
+
+// addKindAt adds a tile of the given kind and value at the specified position
+func (b *Board) addKindAt(x, y, v int, kind tileKind) bool {
+	t := b.newTile(v, x, y)
+	t.kind = kind
+	return b.insertTile(t)
+}
+
+// addRandomSpecialTile adds a random tile, which is a special one with a chance of one in
+// specialOdds
+func (b *Board) addRandomSpecialTile() {
+	kind := tileNumber
+	if b.rand.Intn(specialOdds) == 0 {
+		kinds := []tileKind{tileWild, tileBomb, tileMultiplier, tileStone}
+		kind = kinds[b.rand.Intn(len(kinds))]
+	}
+	t := b.addRandomTile()
+	if !tileKinds[kind].valued && kind != tileNumber {
+		t.SetValue(0)
+	}
+	t.kind = kind
+}
+
+// explode clears the fields next to the given one, when a bomb has merged there
+func (b *Board) explode(x, y int) {
+	for _, t := range b.neighbors(x, y) {
+		if b.ctrl != nil {
+			cx, cy := b.ctrl.fieldCenter(t.x, t.y)
+			b.ctrl.Emit(cx, cy, t.Value())
+		}
+		b.removeTile(t)
+		t.destroy()
+	}
+}
+
+// HandleSpecialsButton starts a game in which some of the random tiles are special tiles
+func (ctrl *Control) HandleSpecialsButton() {
+	ctrl.LevelScreen.Set("visible", false)
+	ctrl.HandleVersusClose()
+	ctrl.level = nil
+	board.start = ""
+	board.rule = ""
+	board.setHex(false)
+	board.specials = true
+	ctrl.HandleRestartButton()
+	ctrl.SetMessage("Special tiles", "wildcards, bombs, multipliers and stones")
+}
+
+// ### ATTACK MODE ###
+
+// stoneDrop stands for a stone dropped on the board in the moves of a recording
+const stoneDrop = 'S'
+
+// attackStones returns the number of stones a move sends to the opponent in attack games, given
+// the values of the tiles its merges created: one for a merge into 32, two into 64 and so on
+// (at most four per merge), and one more for three merges or more in one move
+func attackStones(merges []int) int {
+	n := 0
+	for _, v := range merges {
+		if v >= 9 {
+			n += 4
+		} else if v >= 5 {
+			n += v - 4
+		}
+	}
+	if len(merges) >= 3 {
+		n++
+	}
+	return n
+}
+
+// dropStones puts up to n stones on the board and records them with the moves. Like the garbage
+// in falling block games, the stones fill the board from the bottom up; the field in each row
+// only depends on the board, so replaying the moves puts them at the same fields.
+func (b *Board) dropStones(n int) {
+	for ; n > 0; n-- {
+		x, y, ok := b.stoneField()
+		if !ok {
+			return
+		}
+		b.addKindAt(x, y, 0, tileStone)
+		b.moves = append(b.moves, stoneDrop)
+	}
+}
+
+// stoneField returns the field the next stone drops on: the first free field from the bottom,
+// starting at a column which changes with every move
+func (b *Board) stoneField() (x, y int, ok bool) {
+	for y = b.height - 1; y >= 0; y-- {
+		for i := 0; i < b.width; i++ {
+			x = (len(b.moves) + i) % b.width
+			if b.free(x, y) {
+				return x, y, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// ### MODELS ###
+
+// kindModels caches the generated models of the special tiles by kind and value, which are the
+// same in all themes
+var (
+	kindMutex  sync.Mutex
+	kindModels = make(map[[2]int]map[string]*Object)
+)
+
+// tileModel returns the model of a tile: the one for its value in the theme, or the one of its
+// kind for special tiles
+func (t *Theme) tileModel(nvalue int, kind tileKind) map[string]*Object {
+	if kind == tileNumber {
+		return t.model(nvalue)
+	}
+	if !tileKinds[kind].valued {
+		nvalue = 0
+	}
+	kindMutex.Lock()
+	defer kindMutex.Unlock()
+	m, ok := kindModels[[2]int{int(kind), nvalue}]
+	if !ok {
+		m = generateKindModel(kind, nvalue)
+		kindModels[[2]int{int(kind), nvalue}] = m
+	}
+	return m
+}
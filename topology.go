@@ -0,0 +1,213 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// topology describes the shape of a board: its cells, the directions the tiles can be moved in,
+// and where the cells are shown. Cells are addressed by x and y within a bounding box of
+// size() cells, as in board layouts (see parseBoard); boxes may contain fields which are not
+// cells of the board.
+type topology interface {
+	// size returns the size of the bounding box of the cells
+	size() (w, h int)
+	// contains returns whether x, y is a cell of the board
+	contains(x, y int) bool
+	// directions returns the letters of the moves on the board (see Recording)
+	directions() string
+	// step returns the offset from a cell to its neighbor in the direction of a move; ok is
+	// false for moves the board doesn't have
+	step(dir byte) (dx, dy int, ok bool)
+	// pos returns the position of the top left corner of a cell on screen, in cells
+	pos(x, y int) (px, py float32)
+	// outline returns the corners of a cell on screen, in cells, going round the cell; the
+	// outlines of neighboring cells meet without overlapping
+	outline(x, y int) [][2]float32
+	// extent returns the size of the board on screen, in cells
+	extent() (w, h float32)
+}
+
+// gridTopology is the rectangular board of the original game
+type gridTopology struct {
+	w, h int
+}
+
+func (g gridTopology) size() (int, int) { return g.w, g.h }
+
+func (g gridTopology) contains(x, y int) bool {
+	return x >= 0 && x < g.w && y >= 0 && y < g.h
+}
+
+func (gridTopology) directions() string { return "LRUD" }
+
+func (gridTopology) step(dir byte) (int, int, bool) {
+	switch dir {
+	case 'L':
+		return -1, 0, true
+	case 'R':
+		return 1, 0, true
+	case 'U':
+		return 0, -1, true
+	case 'D':
+		return 0, 1, true
+	}
+	return 0, 0, false
+}
+
+func (gridTopology) pos(x, y int) (float32, float32) { return float32(x), float32(y) }
+
+func (gridTopology) outline(x, y int) [][2]float32 {
+	px, py := float32(x), float32(y)
+	return [][2]float32{{px, py}, {px + 1, py}, {px + 1, py + 1}, {px, py + 1}}
+}
+
+func (g gridTopology) extent() (float32, float32) { return float32(g.w), float32(g.h) }
+
+// hexRadius is the number of rings of cells around the center cell of the hex board
+const hexRadius = 2
+
+// hexTopology is a hexagonal board of hexagonal cells with pointy tops, in rows which are
+// shifted by half a cell against each other. The cells are stored in axial coordinates: x
+// runs along the rows, y down to the right, so the box has corners which are not on the board.
+// Tiles move left (L) and right (R) along the rows, and up left (Q), up right (E), down left (Z)
+// and down right (C), named after the keys around S.
+type hexTopology struct {
+	radius int
+}
+
+func (t hexTopology) size() (int, int) { return 2*t.radius + 1, 2*t.radius + 1 }
+
+func (t hexTopology) contains(x, y int) bool {
+	w, _ := t.size()
+	return x >= 0 && x < w && y >= 0 && y < w && x+y >= t.radius && x+y <= 3*t.radius
+}
+
+func (hexTopology) directions() string { return "LRQEZC" }
+
+func (hexTopology) step(dir byte) (int, int, bool) {
+	switch dir {
+	case 'L':
+		return -1, 0, true
+	case 'R':
+		return 1, 0, true
+	case 'Q':
+		return 0, -1, true
+	case 'E':
+		return 1, -1, true
+	case 'Z':
+		return -1, 1, true
+	case 'C':
+		return 0, 1, true
+	}
+	return 0, 0, false
+}
+
+// hexSide is the length of the sides of the hexagonal cells, and hexRowHeight the distance of
+// their rows, relative to the width of a cell. The tiles are centered in the cells, whose
+// corners stick out above and below them.
+var (
+	hexSide      = float32(1 / math.Sqrt(3))
+	hexRowHeight = 3 * hexSide / 2
+)
+
+func (t hexTopology) pos(x, y int) (float32, float32) {
+	return float32(x) + float32(y-t.radius)/2, float32(y)*hexRowHeight + hexSide - 0.5
+}
+
+func (t hexTopology) outline(x, y int) [][2]float32 {
+	px, py := t.pos(x, y)
+	cx, cy := px+0.5, py+0.5
+	return [][2]float32{
+		{cx, cy - hexSide}, {cx + 0.5, cy - hexSide/2}, {cx + 0.5, cy + hexSide/2},
+		{cx, cy + hexSide}, {cx - 0.5, cy + hexSide/2}, {cx - 0.5, cy - hexSide/2},
+	}
+}
+
+func (t hexTopology) extent() (float32, float32) {
+	w, h := t.size()
+	return float32(w), float32(h-1)*hexRowHeight + 2*hexSide
+}
+
+// cells returns all cells of the board, row by row
+func cells(t topology) [][2]int {
+	var res [][2]int
+	w, h := t.size()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if t.contains(x, y) {
+				res = append(res, [2]int{x, y})
+			}
+		}
+	}
+	return res
+}
+
+// moveOrder returns the cells in the order in which their tiles move in the direction dx, dy:
+// the ones farthest in that direction first, so tiles move out of the way of the ones behind
+// them. For the grid, this is the order of the rows or columns (e.g. the bottom row first when
+// moving down).
+func moveOrder(t topology, dx, dy int) [][2]int {
+	res := cells(t)
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i][0]*dx+res[i][1]*dy > res[j][0]*dx+res[j][1]*dy
+	})
+	return res
+}
+
+// screenStep returns the direction of a move on screen, as a unit vector
+func screenStep(t topology, dir byte) (float64, float64) {
+	dx, dy, _ := t.step(dir)
+	x0, y0 := t.pos(0, 0)
+	x1, y1 := t.pos(dx, dy)
+	l := math.Hypot(float64(x1-x0), float64(y1-y0))
+	return float64(x1-x0) / l, float64(y1-y0) / l
+}
+
+// topology returns the shape of the board
+func (b *Board) topology() topology {
+	if b.hex {
+		return hexTopology{radius: hexRadius}
+	}
+	return gridTopology{w: b.width, h: b.height}
+}
+
+// setHex switches the board between the hex board and the grid for the next game
+func (b *Board) setHex(v bool) {
+	b.hex = v
+	b.width, b.height = boardSize, boardSize
+	if v {
+		b.width, b.height = b.topology().size()
+	}
+}
+
+// free returns whether x, y is an empty cell of the board
+func (b *Board) free(x, y int) bool {
+	return b.topology().contains(x, y) && b.tileAt(x, y) == nil
+}
+
+// neighbors returns the tiles next to the cell x, y
+func (b *Board) neighbors(x, y int) []*Tile {
+	var res []*Tile
+	t := b.topology()
+	for i := 0; i < len(t.directions()); i++ {
+		dx, dy, _ := t.step(t.directions()[i])
+		if n := b.tileAt(x+dx, y+dy); n != nil {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// HandleHexButton starts a game on the hex board
+func (ctrl *Control) HandleHexButton() {
+	ctrl.LevelScreen.Set("visible", false)
+	ctrl.HandleVersusClose()
+	ctrl.level = nil
+	board.start = ""
+	board.specials = false
+	board.rule = ctrl.rule
+	board.setHex(true)
+	ctrl.HandleRestartButton()
+	ctrl.SetMessage("Hex board", "Q E / A D / Z C or swipe in six directions")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// defaultVersusTarget is the tile value which wins a versus game, unless set otherwise in the
+// settings
+const defaultVersusTarget = 2048
+
+// versusKeys maps the keys and gamepad buttons of a versus game to the player (0 or 1) and the
+// move. The first player uses the arrow keys and the first gamepad, the second one WASD and
+// the second gamepad, whose buttons are named "Pad2Left" etc.
+var versusKeys = map[string]struct {
+	player int
+	dir    byte
+}{
+	"Left":      {0, 'L'},
+	"Right":     {0, 'R'},
+	"Up":        {0, 'U'},
+	"Down":      {0, 'D'},
+	"PadLeft":   {0, 'L'},
+	"PadRight":  {0, 'R'},
+	"PadUp":     {0, 'U'},
+	"PadDown":   {0, 'D'},
+	"A":         {1, 'L'},
+	"D":         {1, 'R'},
+	"W":         {1, 'U'},
+	"S":         {1, 'D'},
+	"Pad2Left":  {1, 'L'},
+	"Pad2Right": {1, 'R'},
+	"Pad2Up":    {1, 'U'},
+	"Pad2Down":  {1, 'D'},
+}
+
+// versusGame is a race of two players, each on a board of their own. Both boards start with
+// the same seed and place their random tiles independently of the board, so both players get
+// the same tiles. The first player to reach the target tile wins; if both are stuck, the
+// higher score wins. In attack games, big merges drop stones on the opponent's board.
+type versusGame struct {
+	boards [2]*Board
+	target int  // level of the tile to reach
+	winner int  // -1 while the game is running, 0 or 1 for the winner, 2 for a draw
+	attack bool // merges send stones to the opponent (see attackStones)
+	online bool // played against a player on the match server, which decides who has won
+}
+
+// newVersusGame starts a versus game on simulated boards
+func newVersusGame(seed int64, target int) *versusGame {
+	g := &versusGame{target: tileLevel(target), winner: -1}
+	for i := range g.boards {
+		b := &Board{width: boardSize, height: boardSize}
+		b.newGame(seed)
+		b.shared = true
+		g.boards[i] = b
+	}
+	return g
+}
+
+// move executes a move of a player (or drops a stone for stoneDrop), unless the game is over.
+// It returns the number of stones the move sends to the opponent in attack games: locally, they
+// are dropped on the other board right away, online the match server passes them on.
+func (g *versusGame) move(player int, dir byte) int {
+	if g.winner >= 0 {
+		return 0
+	}
+	b := g.boards[player]
+	b.replayMove(dir)
+	stones := 0
+	if g.attack && dir != stoneDrop {
+		stones = attackStones(b.merges)
+	}
+	if !g.online {
+		g.boards[1-player].dropStones(stones)
+		g.checkEnd()
+	}
+	return stones
+}
+
+// checkEnd sets the winner once the game is over
+func (g *versusGame) checkEnd() {
+	stuck := 0
+	for i, b := range g.boards {
+		if b.bestTile() >= g.target {
+			g.winner = i
+			return
+		}
+		if _, ok := b.bestMove(); !ok {
+			stuck++
+		}
+	}
+	if stuck < len(g.boards) {
+		return
+	}
+	switch s0, s1 := g.boards[0].score, g.boards[1].score; {
+	case s0 > s1:
+		g.winner = 0
+	case s1 > s0:
+		g.winner = 1
+	default:
+		g.winner = 2
+	}
+}
+
+// bestTile returns the value of the highest tile on the board
+func (b *Board) bestTile() int {
+	best := 0
+	for _, t := range b.tiles {
+		if t != nil && t.Value() > best {
+			best = t.Value()
+		}
+	}
+	return best
+}
+
+// ### VERSUS MODE ###
+
+// HandleVersusButton starts a versus game for two players on this computer
+func (ctrl *Control) HandleVersusButton() {
+	ctrl.openVersus(false)
+}
+
+// HandleAttackButton starts a versus game in which big merges drop stones on the opponent
+func (ctrl *Control) HandleAttackButton() {
+	ctrl.openVersus(true)
+}
+
+// openVersus leaves the current game for a versus game
+func (ctrl *Control) openVersus(attack bool) {
+	ctrl.LevelScreen.Set("visible", false)
+	ctrl.stopOnline()
+	ctrl.saveLastGame()
+	ctrl.clearQueue()
+	ctrl.paused = false
+	if ctrl.editing {
+		ctrl.setEditing(false)
+	}
+	ctrl.startVersus(attack)
+}
+
+// startVersus starts a new round of the versus game
+func (ctrl *Control) startVersus(attack bool) {
+	target := defaultVersusTarget
+	if ctrl.settings != nil {
+		if t := ctrl.settings.GetVersusTarget(); tileLevel(t) > 0 {
+			target = t
+		}
+	}
+	ctrl.versus = newVersusGame(time.Now().UnixNano(), target)
+	ctrl.versus.attack = attack
+	ctrl.VersusScreen.Set("message", "First to "+strconv.Itoa(target)+" wins")
+	sub := "arrow keys against WASD"
+	if attack {
+		sub += " - big merges throw stones"
+	}
+	ctrl.VersusScreen.Set("submessage", sub)
+	ctrl.VersusScreen.Set("visible", true)
+	ctrl.updateVersus()
+}
+
+// HandleVersusClose leaves the versus game and returns to the game on the main board
+func (ctrl *Control) HandleVersusClose() {
+	ctrl.stopOnline()
+	ctrl.versus = nil
+	ctrl.VersusScreen.Set("visible", false)
+	ctrl.showScore()
+}
+
+// versusInput handles a key or gamepad button of one of the players in a versus game; it
+// returns false if the key does not belong to a player. Online, the player has the board on
+// the left and uses the normal key bindings.
+func (ctrl *Control) versusInput(name string) bool {
+	player, dir, ok := 0, byte(0), false
+	if ctrl.online != nil {
+		dir, ok = actionMoves[ctrl.bindings.actions[name]]
+	} else if k, found := versusKeys[name]; found {
+		player, dir, ok = k.player, k.dir, true
+	}
+	if !ok {
+		return false
+	}
+	g := ctrl.versus
+	if g == nil || g.winner >= 0 {
+		return true
+	}
+	b := g.boards[player]
+	n := len(b.moves)
+	g.move(player, dir)
+	if ctrl.online != nil && len(b.moves) > n {
+		ctrl.sendMove(b, dir)
+	}
+	ctrl.updateVersus()
+	return true
+}
+
+// updateVersus shows the boards and scores of the versus game, and the winner once it is over
+func (ctrl *Control) updateVersus() {
+	g := ctrl.versus
+	for i, b := range g.boards {
+		n := strconv.Itoa(i + 1)
+		name := "Player " + n
+		if g.online {
+			name = []string{"You", "Opponent"}[i]
+		}
+		ctrl.VersusScreen.ObjectByName("versusScore"+n).Set("text", name+": "+strconv.Itoa(b.score))
+		ctrl.VersusScreen.ObjectByName("versusView" + n).Call("update")
+	}
+	if g.online {
+		// see handleNetMessage
+		return
+	}
+	switch g.winner {
+	case 0, 1:
+		ctrl.VersusScreen.Set("message", "Player "+strconv.Itoa(g.winner+1)+" wins!")
+	case 2:
+		ctrl.VersusScreen.Set("message", "It's a draw!")
+	default:
+		return
+	}
+	ctrl.VersusScreen.Set("submessage", "click 'Restart' for another round")
+}
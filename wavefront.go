@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -14,10 +15,16 @@ type Object struct {
 	Groups []*Group
 }
 
+// Group holds the triangles of an object which share a material. A new group is started
+// by each "g" and "usemtl" statement.
 type Group struct {
+	Name     string
 	Vertexes []float32
 	Normals  []float32
 	Material *Material
+
+	// line segments ("l" statements), two vertexes per segment
+	Lines []float32
 }
 
 type Material struct {
@@ -28,6 +35,158 @@ type Material struct {
 	Shininess float32
 }
 
+// ParseError describes a problem found while reading an OBJ or MTL file.
+// Use errors.As to get at the details.
+type ParseError struct {
+	File      string
+	Line      int    // line number of the offending field (or of the first line of the statement)
+	Column    int    // column of the offending field in its line, 0 if the whole statement is affected
+	Statement string // statement keyword, e.g. "f" or "usemtl"
+	Msg       string
+	Err       error // underlying error, if any
+}
+
+func (e *ParseError) Error() string {
+	pos := fmt.Sprintf("%s:%d", e.File, e.Line)
+	if e.Column > 0 {
+		pos += fmt.Sprintf(":%d", e.Column)
+	}
+	msg := e.Msg
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Statement == "" {
+		return pos + ": " + msg
+	}
+	return fmt.Sprintf("%s: %s statement: %s", pos, e.Statement, msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// field is a whitespace separated part of a statement
+type field struct {
+	text string
+	line int // line the field is on, which differs from the statement's for continued lines
+	col  int // 1-based, within the line
+}
+
+// statement is a logical line of an OBJ or MTL file, split into fields
+type statement struct {
+	file   string
+	line   int
+	fields []field
+}
+
+// fail returns a ParseError for the statement. arg is the index of the field causing the
+// problem (the keyword being field 0), or -1 if the statement as a whole is affected.
+func (s *statement) fail(arg int, err error, format string, a ...interface{}) error {
+	e := &ParseError{File: s.file, Line: s.line, Msg: fmt.Sprintf(format, a...), Err: err}
+	if len(s.fields) > 0 {
+		e.Statement = s.fields[0].text
+	}
+	if arg >= 0 && arg < len(s.fields) {
+		e.Line = s.fields[arg].line
+		e.Column = s.fields[arg].col
+	}
+	return e
+}
+
+// floats parses the fields starting at index 1 as floats into dst
+func (s *statement) floats(dst []float32) error {
+	if len(s.fields) != len(dst)+1 {
+		return s.fail(-1, nil, "expected %d values, got %d", len(dst), len(s.fields)-1)
+	}
+	for i := range dst {
+		f, err := strconv.ParseFloat(s.fields[i+1].text, 32)
+		if err != nil {
+			return s.fail(i+1, nil, "cannot parse float %q", s.fields[i+1].text)
+		}
+		dst[i] = float32(f)
+	}
+	return nil
+}
+
+// statementReader reads the statements of an OBJ or MTL file. Lines may be arbitrarily long;
+// lines ending in a backslash are joined with the following line. Comments are removed.
+type statementReader struct {
+	r    *bufio.Reader
+	file string
+	lno  int
+}
+
+func newStatementReader(r io.Reader, file string) *statementReader {
+	return &statementReader{r: bufio.NewReader(r), file: file}
+}
+
+// next returns the next non-empty statement, or io.EOF at the end of the file
+func (sr *statementReader) next() (*statement, error) {
+	for {
+		var line string
+		start := sr.lno + 1
+		// offsets of the physical lines within the joined line
+		var offsets []int
+		for {
+			part, err := sr.r.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return nil, &ParseError{File: sr.file, Line: sr.lno + 1, Msg: "read error", Err: err}
+			}
+			if part == "" && err == io.EOF {
+				if line == "" {
+					return nil, io.EOF
+				}
+				break
+			}
+			sr.lno++
+			offsets = append(offsets, len(line))
+			part = strings.TrimRight(part, "\r\n")
+			// a backslash in a comment doesn't continue the line
+			if i := strings.IndexByte(part, '#'); i >= 0 {
+				part = part[:i]
+			}
+			if strings.HasSuffix(part, "\\") && err == nil {
+				line += part[:len(part)-1] + " "
+				continue
+			}
+			line += part
+			break
+		}
+
+		s := &statement{file: sr.file, line: start, fields: splitFields(line)}
+		// translate the columns in the joined line to the physical lines
+		for i := range s.fields {
+			f := &s.fields[i]
+			n := len(offsets) - 1
+			for n > 0 && offsets[n] >= f.col {
+				n--
+			}
+			f.line = start + n
+			f.col -= offsets[n]
+		}
+		if len(s.fields) > 0 {
+			return s, nil
+		}
+	}
+}
+
+// splitFields splits a line at whitespace, remembering the column of each field
+func splitFields(line string) []field {
+	var fields []field
+	start := -1
+	for i := 0; i <= len(line); i++ {
+		space := i == len(line) || line[i] == ' ' || line[i] == '\t' || line[i] == '\f' || line[i] == '\v'
+		if space && start >= 0 {
+			fields = append(fields, field{text: line[start:i], col: start + 1})
+			start = -1
+		} else if !space && start < 0 {
+			start = i
+		}
+	}
+	return fields
+}
+
+// Read reads the objects from an OBJ file, along with the material libraries it references
 func Read(filename string) (map[string]*Object, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -35,229 +194,279 @@ func Read(filename string) (map[string]*Object, error) {
 	}
 	defer file.Close()
 
-	var materials map[string]*Material
+	dir := filepath.Dir(filename)
+	return ReadFrom(file, filename, func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, name))
+	})
+}
+
+// ReadFrom reads the objects from an OBJ file given as a reader. filename is only used in
+// error messages; openLib is called to open the material libraries referenced by the file.
+func ReadFrom(r io.Reader, filename string, openLib func(name string) (io.ReadCloser, error)) (map[string]*Object, error) {
+	var materials = make(map[string]*Material)
 	var objects = make(map[string]*Object)
 	var object *Object
 	var group *Group
 	var vertex []float32
 	var normal []float32
 
-	lno := 0
-	line := ""
-	scanner := bufio.NewScanner(file)
+	// state for the next group
+	groupName := ""
+	material := newMaterial("")
 
-	fail := func(msg string) error {
-		return fmt.Errorf(msg+" at %s:%d: %s", filename, lno, line)
+	// curGroup returns the group new elements are added to, creating it (and an object,
+	// if the file doesn't declare any) if necessary
+	curGroup := func() *Group {
+		if object == nil {
+			object = &Object{Name: strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))}
+			objects[object.Name] = object
+		}
+		if group == nil {
+			group = &Group{Name: groupName, Material: material}
+			object.Groups = append(object.Groups, group)
+		}
+		return group
 	}
 
-	for scanner.Scan() {
-		lno++
-		line = scanner.Text()
-		if strings.HasPrefix(line, "#") {
-			continue
+	sr := newStatementReader(r, filename)
+	for {
+		s, err := sr.next()
+		if err == io.EOF {
+			break
 		}
-
-		fields := strings.Fields(line)
-		if len(fields) == 0 {
-			continue
+		if err != nil {
+			return nil, err
 		}
+		f := s.fields
 
-		if fields[0] == "mtllib" {
-			if len(fields) != 2 {
-				return nil, fail("unsupported materials library line")
+		switch f[0].text {
+		case "mtllib":
+			if len(f) < 2 {
+				return nil, s.fail(-1, nil, "missing file name")
 			}
-			materials, err = readMaterials(filepath.Join(filepath.Dir(filename), fields[1]))
-			if err != nil {
-				return nil, err
+			for i := 1; i < len(f); i++ {
+				lib, err := openLib(f[i].text)
+				if err != nil {
+					return nil, s.fail(i, err, "cannot read referenced material library")
+				}
+				err = readMaterials(lib, filepath.Join(filepath.Dir(filename), f[i].text), materials)
+				lib.Close()
+				if err != nil {
+					return nil, err
+				}
 			}
-			continue
-		}
-
-		if fields[0] == "o" {
-			if len(fields) != 2 {
-				return nil, fail("unsupported object line")
+		case "o":
+			if len(f) != 2 {
+				return nil, s.fail(-1, nil, "unsupported object line")
 			}
-			object = &Object{Name: fields[1]}
+			object = &Object{Name: f[1].text}
 			objects[object.Name] = object
 			group = nil
-			continue
-		}
-
-		if object == nil {
-			return nil, fail("found data before object")
-		}
-
-		if fields[0] == "usemtl" {
-			group = &Group{}
-			object.Groups = append(object.Groups, group)
-		}
-
-		switch fields[0] {
+		case "g":
+			groupName = ""
+			if len(f) > 1 {
+				var names []string
+				for _, n := range f[1:] {
+					names = append(names, n.text)
+				}
+				groupName = strings.Join(names, " ")
+			}
+			group = nil
 		case "usemtl":
-			if len(fields) != 2 {
-				return nil, fail("unsupported material usage line")
+			if len(f) != 2 {
+				return nil, s.fail(-1, nil, "unsupported material usage line")
 			}
-			group.Material = materials[fields[1]]
-			if group.Material == nil {
-				return nil, fmt.Errorf("material %q not defined", fields[1])
+			material = materials[f[1].text]
+			if material == nil {
+				return nil, s.fail(1, nil, "material %q not defined", f[1].text)
 			}
+			group = nil
+		case "s":
+			// smoothing groups are irrelevant, as normals are given explicitly
+			// (or the faces are flat)
 		case "v":
-			if len(fields) != 4 {
-				return nil, fail("unsupported vertex line")
+			// the optional w coordinate is ignored
+			if len(f) == 5 {
+				s.fields = f[:4]
 			}
-			for i := 0; i < 3; i++ {
-				f, err := strconv.ParseFloat(fields[i+1], 32)
-				if err != nil {
-					return nil, fail("cannot parse float")
-				}
-				vertex = append(vertex, float32(f))
+			v := make([]float32, 3)
+			if err := s.floats(v); err != nil {
+				return nil, err
 			}
+			vertex = append(vertex, v...)
 		case "vn":
-			if len(fields) != 4 {
-				return nil, fail("unsupported vertex normal line")
+			n := make([]float32, 3)
+			if err := s.floats(n); err != nil {
+				return nil, err
+			}
+			normal = append(normal, n...)
+		case "vt", "vp":
+			// texture coordinates are not used
+		case "f":
+			if len(f) < 4 {
+				return nil, s.fail(-1, nil, "a face needs at least three vertexes")
 			}
-			for i := 0; i < 3; i++ {
-				f, err := strconv.ParseFloat(fields[i+1], 32)
+			vis := make([]int, len(f)-1)
+			nis := make([]int, len(f)-1)
+			for i := range vis {
+				vis[i], nis[i], err = s.faceVertex(i+1, len(vertex)/3, len(normal)/3)
 				if err != nil {
-					return nil, fail("cannot parse float")
+					return nil, err
 				}
-				normal = append(normal, float32(f))
 			}
-		case "f":
-			if len(fields) != 4 {
-				return nil, fail("unsupported face line")
-			}
-			for i := 0; i < 3; i++ {
-				face := strings.Split(fields[i+1], "/")
-				if len(face) != 3 {
-					return nil, fail("unsupported face shape (not a triangle)")
+			g := curGroup()
+			// polygons are triangulated as a fan
+			for i := 1; i+1 < len(vis); i++ {
+				for _, k := range []int{0, i, i + 1} {
+					vi := vis[k] * 3
+					g.Vertexes = append(g.Vertexes, vertex[vi], vertex[vi+1], vertex[vi+2])
 				}
-				vi, err := strconv.Atoi(face[0])
-				if err != nil {
-					return nil, fail("unsupported face vertex index")
+				if nis[0] >= 0 && nis[i] >= 0 && nis[i+1] >= 0 {
+					for _, k := range []int{0, i, i + 1} {
+						ni := nis[k] * 3
+						g.Normals = append(g.Normals, normal[ni], normal[ni+1], normal[ni+2])
+					}
+				} else {
+					n := faceNormal(g.Vertexes[len(g.Vertexes)-9:])
+					g.Normals = append(g.Normals, n[0], n[1], n[2], n[0], n[1], n[2], n[0], n[1], n[2])
 				}
-				ni, err := strconv.Atoi(face[2])
+			}
+		case "l":
+			if len(f) < 3 {
+				return nil, s.fail(-1, nil, "a line needs at least two vertexes")
+			}
+			vis := make([]int, len(f)-1)
+			for i := range vis {
+				vis[i], _, err = s.faceVertex(i+1, len(vertex)/3, 0)
 				if err != nil {
-					return nil, fail("unsupported face normal index")
+					return nil, err
 				}
-				vi = (vi - 1) * 3
-				ni = (ni - 1) * 3
-				group.Vertexes = append(group.Vertexes, vertex[vi], vertex[vi+1], vertex[vi+2])
-				group.Normals = append(group.Normals, normal[ni], normal[ni+1], normal[ni+2])
+			}
+			g := curGroup()
+			for i := 0; i+1 < len(vis); i++ {
+				a, b := vis[i]*3, vis[i+1]*3
+				g.Lines = append(g.Lines, vertex[a], vertex[a+1], vertex[a+2], vertex[b], vertex[b+1], vertex[b+2])
 			}
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
 	return objects, nil
 }
 
-func readMaterials(filename string) (map[string]*Material, error) {
-	file, err := os.Open(filename)
+// faceVertex parses the vertex reference in field i of a face or line statement
+// ("v", "v/vt", "v//vn" or "v/vt/vn"; negative indexes count back from the last element).
+// It returns zero-based vertex and normal indexes; the normal index is -1 if there is none.
+func (s *statement) faceVertex(i, nv, nn int) (vi, ni int, err error) {
+	parts := strings.Split(s.fields[i].text, "/")
+	if len(parts) > 3 {
+		return 0, 0, s.fail(i, nil, "unsupported vertex reference %q", s.fields[i].text)
+	}
+	index := func(text string, n int, what string) (int, error) {
+		idx, err := strconv.Atoi(text)
+		if err != nil {
+			return 0, s.fail(i, nil, "cannot parse %s index %q", what, text)
+		}
+		if idx < 0 {
+			idx += n
+		} else {
+			idx--
+		}
+		if idx < 0 || idx >= n {
+			return 0, s.fail(i, nil, "%s index %s out of range", what, text)
+		}
+		return idx, nil
+	}
+
+	vi, err = index(parts[0], nv, "vertex")
 	if err != nil {
-		return nil, fmt.Errorf("cannot read referenced material library: %v", err)
+		return 0, 0, err
 	}
-	defer file.Close()
+	ni = -1
+	if len(parts) == 3 && parts[2] != "" {
+		ni, err = index(parts[2], nn, "normal")
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return vi, ni, nil
+}
 
-	var materials = make(map[string]*Material)
-	var material *Material
+// faceNormal calculates the normal of a triangle given by 9 coordinates
+func faceNormal(v []float32) [3]float32 {
+	e1 := [3]float32{v[3] - v[0], v[4] - v[1], v[5] - v[2]}
+	e2 := [3]float32{v[6] - v[0], v[7] - v[1], v[8] - v[2]}
+	n := [3]float32{e1[1]*e2[2] - e1[2]*e2[1], e1[2]*e2[0] - e1[0]*e2[2], e1[0]*e2[1] - e1[1]*e2[0]}
+	if n == [3]float32{} {
+		return [3]float32{0, 0, 1}
+	}
+	return normalize(n)
+}
 
-	lno := 0
-	line := ""
-	scanner := bufio.NewScanner(file)
+// newMaterial creates a material with the default colors
+func newMaterial(name string) *Material {
+	material := &Material{Name: name}
+	material.Ambient = []float32{0.2, 0.2, 0.2, 1.0}
+	material.Diffuse = []float32{0.8, 0.8, 0.8, 1.0}
+	material.Specular = []float32{0.0, 0.0, 0.0, 1.0}
+	return material
+}
 
-	fail := func(msg string) error {
-		return fmt.Errorf(msg+" at %s:%d: %s", filename, lno, line)
-	}
+// readMaterials reads the materials from an MTL file and adds them to materials
+func readMaterials(r io.Reader, filename string, materials map[string]*Material) error {
+	var material *Material
 
-	for scanner.Scan() {
-		lno++
-		line = scanner.Text()
-		if strings.HasPrefix(line, "#") {
-			continue
+	sr := newStatementReader(r, filename)
+	for {
+		s, err := sr.next()
+		if err == io.EOF {
+			break
 		}
-
-		fields := strings.Fields(line)
-		if len(fields) == 0 {
-			continue
+		if err != nil {
+			return err
 		}
+		f := s.fields
 
-		if fields[0] == "newmtl" {
-			if len(fields) != 2 {
-				return nil, fail("unsupported material definition")
+		if f[0].text == "newmtl" {
+			if len(f) != 2 {
+				return s.fail(-1, nil, "unsupported material definition")
 			}
-			material = &Material{Name: fields[1]}
-			material.Ambient = []float32{0.2, 0.2, 0.2, 1.0}
-			material.Diffuse = []float32{0.8, 0.8, 0.8, 1.0}
-			material.Specular = []float32{0.0, 0.0, 0.0, 1.0}
+			material = newMaterial(f[1].text)
 			materials[material.Name] = material
 			continue
 		}
 
 		if material == nil {
-			return nil, fail("found data before material")
+			return s.fail(0, nil, "found data before material")
 		}
 
-		switch fields[0] {
+		switch f[0].text {
 		case "Ka":
-			if len(fields) != 4 {
-				return nil, fail("unsupported ambient color line")
-			}
-			for i := 0; i < 3; i++ {
-				f, err := strconv.ParseFloat(fields[i+1], 32)
-				if err != nil {
-					return nil, fail("cannot parse float")
-				}
-				material.Ambient[i] = float32(f)
+			if err := s.floats(material.Ambient[:3]); err != nil {
+				return err
 			}
 		case "Kd":
-			if len(fields) != 4 {
-				return nil, fail("unsupported diffuse color line")
-			}
-			for i := 0; i < 3; i++ {
-				f, err := strconv.ParseFloat(fields[i+1], 32)
-				if err != nil {
-					return nil, fail("cannot parse float")
-				}
-				material.Diffuse[i] = float32(f)
+			if err := s.floats(material.Diffuse[:3]); err != nil {
+				return err
 			}
 		case "Ks":
-			if len(fields) != 4 {
-				return nil, fail("unsupported specular color line")
-			}
-			for i := 0; i < 3; i++ {
-				f, err := strconv.ParseFloat(fields[i+1], 32)
-				if err != nil {
-					return nil, fail("cannot parse float")
-				}
-				material.Specular[i] = float32(f)
+			if err := s.floats(material.Specular[:3]); err != nil {
+				return err
 			}
 		case "Ns":
-			if len(fields) != 2 {
-				return nil, fail("unsupported shininess line")
-			}
-			f, err := strconv.ParseFloat(fields[1], 32)
-			if err != nil {
-				return nil, fail("cannot parse float")
+			v := make([]float32, 1)
+			if err := s.floats(v); err != nil {
+				return err
 			}
-			material.Shininess = float32(f / 1000 * 128)
+			material.Shininess = v[0] / 1000 * 128
 		case "d":
-			if len(fields) != 2 {
-				return nil, fail("unsupported transparency line")
+			v := make([]float32, 1)
+			if err := s.floats(v); err != nil {
+				return err
 			}
-			f, err := strconv.ParseFloat(fields[1], 32)
-			if err != nil {
-				return nil, fail("cannot parse float")
-			}
-			material.Ambient[3] = float32(f)
-			material.Diffuse[3] = float32(f)
-			material.Specular[3] = float32(f)
+			material.Ambient[3] = v[0]
+			material.Diffuse[3] = v[0]
+			material.Specular[3] = v[0]
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
 
 	// Exporting from blender seems to show everything too dark in
 	// practice, so hack colors to look closer to what we see there.
@@ -276,5 +485,5 @@ func readMaterials(filename string) (map[string]*Material, error) {
 		}
 	}*/
 
-	return materials, nil
+	return nil
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// readString reads an OBJ file given as a string; the material libraries are taken from libs
+func readString(obj string, libs map[string]string) (map[string]*Object, error) {
+	return ReadFrom(strings.NewReader(obj), "test.obj", func(name string) (io.ReadCloser, error) {
+		lib, ok := libs[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return ioutil.NopCloser(strings.NewReader(lib)), nil
+	})
+}
+
+func TestReadContinuationLines(t *testing.T) {
+	obj := "v 0 0 0\n" +
+		"v 1 \\\n0 0\n" +
+		"v 0 1 0 # comment\n" +
+		"f 1 \\\r\n 2 \\\n3\n"
+	objects, err := readString(obj, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := objects["test"].Groups[0]
+	want := []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}
+	if len(g.Vertexes) != len(want) {
+		t.Fatalf("got %d vertex coordinates, want %d", len(g.Vertexes), len(want))
+	}
+	for i := range want {
+		if g.Vertexes[i] != want[i] {
+			t.Errorf("coordinate %d is %g, want %g", i, g.Vertexes[i], want[i])
+		}
+	}
+}
+
+func TestReadCommentEndingInBackslash(t *testing.T) {
+	obj := "v 0 0 0\n" +
+		"v 1 0 0 # comment \\\n" +
+		"v 0 1 0\n" +
+		"f 1 2 3\n"
+	objects, err := readString(obj, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := objects["test"].Groups; len(g) != 1 || len(g[0].Vertexes) != 9 {
+		t.Fatalf("the statements after the comment were not read: %+v", g)
+	}
+}
+
+func TestReadParseErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		obj       string
+		line, col int
+		statement string
+		wrapped   error
+	}{
+		{"bad float", "v 0 x 0\n", 1, 5, "v", nil},
+		{"missing values", "v 0 0 0\nv 1 1\n", 2, 0, "v", nil},
+		{"index out of range", "v 0 0 0\nv 1 0 0\nv 0 1 0\n\nf 1 2  4\n", 5, 8, "f", nil},
+		{"continued line", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 \\\n  2 \\\n\t7\n", 6, 2, "f", nil},
+		{"continued statement", "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 \\\n2\n", 4, 0, "f", nil},
+		{"missing material", "usemtl \\\n  red\n", 2, 3, "usemtl", nil},
+		{"missing library", "mtllib a.mtl b.mtl\n", 1, 14, "mtllib", os.ErrNotExist},
+	}
+	for _, test := range tests {
+		_, err := readString(test.obj, map[string]string{"a.mtl": "newmtl red\n"})
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: got %v, want a ParseError", test.name, err)
+			continue
+		}
+		if pe.File != "test.obj" || pe.Line != test.line || pe.Column != test.col || pe.Statement != test.statement {
+			t.Errorf("%s: got %s:%d:%d (%s), want test.obj:%d:%d (%s)", test.name,
+				pe.File, pe.Line, pe.Column, pe.Statement, test.line, test.col, test.statement)
+		}
+		if errors.Unwrap(err) != test.wrapped {
+			t.Errorf("%s: unwrapped error is %v, want %v", test.name, errors.Unwrap(err), test.wrapped)
+		}
+		if test.wrapped != nil && !errors.Is(err, test.wrapped) {
+			t.Errorf("%s: %v is not %v", test.name, err, test.wrapped)
+		}
+	}
+}
+
+func TestReadMaterialParseError(t *testing.T) {
+	_, err := readString("mtllib a.mtl\n", map[string]string{"a.mtl": "newmtl red\nKd 1 \\\n 0 q\n"})
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, want a ParseError", err)
+	}
+	if pe.File != "a.mtl" || pe.Line != 3 || pe.Column != 4 || pe.Statement != "Kd" {
+		t.Errorf("got %s:%d:%d (%s), want a.mtl:3:4 (Kd)", pe.File, pe.Line, pe.Column, pe.Statement)
+	}
+	if want := "a.mtl:3:4: Kd statement: cannot parse float \"q\""; pe.Error() != want {
+		t.Errorf("got message %q, want %q", pe.Error(), want)
+	}
+}